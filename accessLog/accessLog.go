@@ -0,0 +1,238 @@
+// Package accessLog writes one line per HTTP request in a standard access
+// log format (Apache Common or Combined, W3C extended, Elastic Common
+// Schema JSON) or a user supplied template.
+//
+// example:
+//
+//	al, _ := accessLog.New(accessLog.WithFormat(accessLog.ECS),
+//		accessLog.WithOutput(accessLog.NewAsyncWriter(os.Stdout)))
+//	defer al.Close()
+//	http.ListenAndServe(":8080", al.Handler(mux))
+package accessLog
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/correlationID"
+	"github.com/mchudgins/go-service-helper/httpWriter"
+	"github.com/mchudgins/go-service-helper/route"
+	"github.com/mchudgins/go-service-helper/user"
+)
+
+// Entry describes a completed request.
+type Entry struct {
+	Time          time.Time     // when the request was received
+	Duration      time.Duration // time taken to respond
+	RemoteAddr    string        // client address, as host:port
+	User          string        // authenticated user, if known
+	Method        string
+	URI           string // request URI, with sensitive query parameters redacted
+	Path          string
+	Query         string // raw query, with sensitive parameters redacted
+	Proto         string
+	Host          string
+	Status        int
+	Size          int // response body bytes
+	Referer       string
+	UserAgent     string
+	CorrelationID string
+	Route         string
+	Request       *http.Request // for templates which need other headers
+}
+
+// RemoteHost returns the client address without the port.
+func (e *Entry) RemoteHost() string {
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		return e.RemoteAddr
+	}
+	return host
+}
+
+// AccessLogger is HTTP middleware which writes an Entry, in its format,
+// for each request.
+type AccessLogger struct {
+	format      Formatter
+	out         io.Writer
+	redactQuery QueryRedactor
+	sampler     *Sampler
+	corrHeader  string
+	mutex       sync.Mutex
+}
+
+type Option func(*AccessLogger) error
+
+// New returns an AccessLogger which, by default, writes the Combined
+// format to os.Stdout.
+func New(opts ...Option) (*AccessLogger, error) {
+	a := &AccessLogger{
+		format: Combined,
+		out:    os.Stdout,
+	}
+	RedactQuery(SensitiveQueryParameters...)(a)
+
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	// formats, such as W3C, begin each file with directives
+	if h, ok := a.format.(Header); ok {
+		a.out.Write(h.Header())
+		if aw, ok := a.out.(*AsyncWriter); ok {
+			aw.OnRotate(func(w io.Writer) error {
+				_, err := w.Write(h.Header())
+				return err
+			})
+		}
+	}
+
+	return a, nil
+}
+
+func WithFormat(f Formatter) Option {
+	return func(a *AccessLogger) error {
+		if f == nil {
+			return fmt.Errorf("accessLog.WithFormat requires a non-nil Formatter")
+		}
+		a.format = f
+		return nil
+	}
+}
+
+// WithOutput sets where entries are written.  Use an AsyncWriter to keep
+// slow writers off the request path.
+func WithOutput(w io.Writer) Option {
+	return func(a *AccessLogger) error {
+		if w == nil {
+			return fmt.Errorf("accessLog.WithOutput requires a non-nil io.Writer")
+		}
+		a.out = w
+		return nil
+	}
+}
+
+// RedactQuery replaces the set of query parameters whose values are
+// logged as [REDACTED]; by default, SensitiveQueryParameters.
+func RedactQuery(names ...string) Option {
+	return func(a *AccessLogger) error {
+		a.redactQuery = NewQueryRedactor(names...)
+		return nil
+	}
+}
+
+// WithSampler logs only the requests chosen by the Sampler.
+func WithSampler(s *Sampler) Option {
+	return func(a *AccessLogger) error {
+		if s == nil {
+			return fmt.Errorf("accessLog.WithSampler requires a non-nil Sampler")
+		}
+		a.sampler = s
+		return nil
+	}
+}
+
+// WithCorrelationID reads the correlation ID of requests which were not
+// tagged by earlier middleware from the Extractor's header, rather than
+// from correlationID.Default()'s.
+func WithCorrelationID(e *correlationID.Extractor) Option {
+	return func(a *AccessLogger) error {
+		if e == nil {
+			return fmt.Errorf("accessLog.WithCorrelationID requires a non-nil Extractor")
+		}
+		a.corrHeader = e.Header()
+		return nil
+	}
+}
+
+// Handler returns the middleware.
+func (a *AccessLogger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := httpWriter.NewHTTPWriter(w)
+
+		// save some values, in case the handler changes 'em
+		e := &Entry{
+			Time:       start,
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			URI:        r.URL.RequestURI(),
+			Path:       r.URL.Path,
+			Query:      a.redactQuery.Redact(r.URL.RawQuery),
+			Proto:      r.Proto,
+			Host:       r.Host,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			Request:    r,
+		}
+		if len(e.Query) > 0 {
+			e.URI = e.Path + "?" + e.Query
+		}
+
+		defer func() {
+			ctx := r.Context()
+
+			e.Duration = time.Since(start)
+			e.Status = lw.StatusCode()
+			if e.Status == 0 {
+				// nothing written; net/http responds 200 OK
+				e.Status = http.StatusOK
+			}
+			e.Route = route.FromContext(ctx)
+			if a.sampler != nil && !a.sampler.Sampled(e.Route, e.Status, e.Duration) {
+				return
+			}
+
+			e.Size = lw.Length()
+			e.CorrelationID = correlationID.FromContext(ctx)
+			if len(e.CorrelationID) == 0 {
+				e.CorrelationID = lw.Header().Get(a.correlationHeader())
+			}
+			e.User = user.FromContext(ctx)
+			if len(e.User) == 0 {
+				_, e.User = user.FromRequest(r)
+			}
+
+			a.Log(e)
+		}()
+
+		next.ServeHTTP(lw, r)
+	})
+}
+
+func (a *AccessLogger) correlationHeader() string {
+	if len(a.corrHeader) > 0 {
+		return a.corrHeader
+	}
+	return correlationID.Default().Header()
+}
+
+// Log formats & writes an entry.
+func (a *AccessLogger) Log(e *Entry) {
+	line := a.format.Format(e)
+
+	// an AsyncWriter is safe for concurrent use
+	if _, ok := a.out.(*AsyncWriter); ok {
+		a.out.Write(line)
+		return
+	}
+
+	a.mutex.Lock()
+	a.out.Write(line)
+	a.mutex.Unlock()
+}
+
+// Close flushes & stops the output, if it is an AsyncWriter.
+func (a *AccessLogger) Close() error {
+	if aw, ok := a.out.(*AsyncWriter); ok {
+		return aw.Close()
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package accessLog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	format, err := Template("{{.URI}} {{.Query}} {{.Status}} {{.Size}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		uri     string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{
+			name:    "logged",
+			uri:     "/things?id=1",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated); w.Write([]byte("ok")) },
+			want:    "/things?id=1 id=1 201 2\n",
+		},
+		{
+			name:    "nothing written",
+			uri:     "/things",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			want:    "/things  200 0\n",
+		},
+		{
+			name:    "sensitive parameters redacted",
+			uri:     "/things?id=1&access_token=secret&Password=secret",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			want:    "/things?id=1&access_token=[REDACTED]&Password=[REDACTED] id=1&access_token=[REDACTED]&Password=[REDACTED] 200 0\n",
+		},
+		{
+			name:    "RedactQuery",
+			opts:    []Option{RedactQuery("id")},
+			uri:     "/things?id=1&access_token=secret",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			want:    "/things?id=[REDACTED]&access_token=secret id=[REDACTED]&access_token=secret 200 0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			a, err := New(append([]Option{WithFormat(format), WithOutput(&buf)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			a.Handler(tt.handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.uri, nil))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		err    bool
+		header bool // the format's directives were written
+	}{
+		{name: "defaults"},
+		{name: "W3C", opts: []Option{WithFormat(W3C)}, header: true},
+		{name: "nil format", opts: []Option{WithFormat(nil)}, err: true},
+		{name: "nil output", opts: []Option{WithOutput(nil)}, err: true},
+		{name: "nil sampler", opts: []Option{WithSampler(nil)}, err: true},
+		{name: "nil extractor", opts: []Option{WithCorrelationID(nil)}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := New(append([]Option{WithOutput(&buf)}, tt.opts...)...)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() = %v, want an error: %t", err, tt.err)
+			}
+			if header := strings.HasPrefix(buf.String(), "#Version: 1.0\n"); header != tt.header {
+				t.Errorf("header written = %t, want %t", header, tt.header)
+			}
+		})
+	}
+}
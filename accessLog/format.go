@@ -0,0 +1,277 @@
+package accessLog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Formatter renders an Entry as a single line, including the newline.
+type Formatter interface {
+	Format(e *Entry) []byte
+}
+
+// FormatterFunc adapts a function to a Formatter.
+type FormatterFunc func(e *Entry) []byte
+
+func (f FormatterFunc) Format(e *Entry) []byte {
+	return f(e)
+}
+
+// Header is implemented by Formatters whose output begins with
+// directives, written when the log is opened & after each rotation.
+type Header interface {
+	Header() []byte
+}
+
+const (
+	apacheTimeFormat = "02/Jan/2006:15:04:05 -0700"
+	ecsVersion       = "8.11.0"
+)
+
+var (
+	// Common is the Apache Common Log Format:
+	//	%h %l %u %t "%r" %>s %b
+	Common Formatter = FormatterFunc(func(e *Entry) []byte {
+		var buf bytes.Buffer
+		common(&buf, e)
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	})
+
+	// Combined is the Apache Combined Log Format:
+	//	%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+	Combined Formatter = FormatterFunc(func(e *Entry) []byte {
+		var buf bytes.Buffer
+		common(&buf, e)
+		fmt.Fprintf(&buf, " \"%s\" \"%s\"\n", escape(e.Referer), escape(e.UserAgent))
+		return buf.Bytes()
+	})
+
+	// W3C is the W3C Extended Log File Format, with the fields
+	// date time c-ip cs-username cs-method cs-uri-stem cs-uri-query
+	// sc-status sc-bytes time-taken cs(User-Agent) cs(Referer)
+	W3C Formatter = w3c{}
+
+	// ECS is Elastic Common Schema JSON, one object per line.
+	ECS Formatter = FormatterFunc(ecs)
+)
+
+func common(buf *bytes.Buffer, e *Entry) {
+	size := "-"
+	if e.Size > 0 {
+		size = strconv.Itoa(e.Size)
+	}
+
+	fmt.Fprintf(buf, "%s - %s [%s] \"%s %s %s\" %d %s",
+		dash(e.RemoteHost()),
+		dash(escape(e.User)),
+		e.Time.Format(apacheTimeFormat),
+		escape(e.Method),
+		escape(e.URI),
+		escape(e.Proto),
+		e.Status,
+		size)
+}
+
+// escape quotes, backslashes & control characters, as Apache httpd does
+func escape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&buf, "\\x%02x", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func dash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+type w3c struct{}
+
+func (w3c) Header() []byte {
+	return []byte("#Version: 1.0\n" +
+		"#Software: go-service-helper\n" +
+		"#Fields: date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes time-taken cs(User-Agent) cs(Referer)\n")
+}
+
+func (w3c) Format(e *Entry) []byte {
+	t := e.Time.UTC()
+
+	fields := []string{
+		t.Format("2006-01-02"),
+		t.Format("15:04:05"),
+		e.RemoteHost(),
+		e.User,
+		e.Method,
+		e.Path,
+		e.Query,
+		strconv.Itoa(e.Status),
+		strconv.Itoa(e.Size),
+		strconv.FormatFloat(e.Duration.Seconds(), 'f', 3, 64),
+		e.UserAgent,
+		e.Referer,
+	}
+	for i, field := range fields {
+		fields[i] = w3cField(field)
+	}
+
+	return []byte(strings.Join(fields, " ") + "\n")
+}
+
+// w3cField replaces whitespace with '+', as IIS does, & empty values with '-'
+func w3cField(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return '+'
+		}
+		return r
+	}, s)
+}
+
+type ecsEntry struct {
+	Timestamp string `json:"@timestamp"`
+	ECS       struct {
+		Version string `json:"version"`
+	} `json:"ecs"`
+	Event struct {
+		Kind     string   `json:"kind"`
+		Category []string `json:"category"`
+		Type     []string `json:"type"`
+		Outcome  string   `json:"outcome"`
+		Duration int64    `json:"duration"` // nanoseconds
+	} `json:"event"`
+	HTTP struct {
+		Version string `json:"version,omitempty"`
+		Request struct {
+			ID       string `json:"id,omitempty"`
+			Method   string `json:"method"`
+			Referrer string `json:"referrer,omitempty"`
+		} `json:"request"`
+		Response struct {
+			StatusCode int `json:"status_code"`
+			Body       struct {
+				Bytes int `json:"bytes"`
+			} `json:"body"`
+		} `json:"response"`
+	} `json:"http"`
+	URL struct {
+		Original string `json:"original"`
+		Path     string `json:"path"`
+		Query    string `json:"query,omitempty"`
+		Domain   string `json:"domain,omitempty"`
+	} `json:"url"`
+	Client struct {
+		Address string `json:"address"`
+		IP      string `json:"ip,omitempty"`
+	} `json:"client"`
+	UserAgent *struct {
+		Original string `json:"original"`
+	} `json:"user_agent,omitempty"`
+	User *struct {
+		Name string `json:"name"`
+	} `json:"user,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func ecs(e *Entry) []byte {
+	var out ecsEntry
+
+	out.Timestamp = e.Time.UTC().Format(time.RFC3339Nano)
+	out.ECS.Version = ecsVersion
+
+	out.Event.Kind = "event"
+	out.Event.Category = []string{"web"}
+	out.Event.Type = []string{"access"}
+	out.Event.Outcome = "success"
+	if e.Status >= 400 {
+		out.Event.Outcome = "failure"
+	}
+	out.Event.Duration = e.Duration.Nanoseconds()
+
+	out.HTTP.Version = strings.TrimPrefix(e.Proto, "HTTP/")
+	out.HTTP.Request.ID = e.CorrelationID
+	out.HTTP.Request.Method = e.Method
+	out.HTTP.Request.Referrer = e.Referer
+	out.HTTP.Response.StatusCode = e.Status
+	out.HTTP.Response.Body.Bytes = e.Size
+
+	out.URL.Original = e.URI
+	out.URL.Path = e.Path
+	out.URL.Query = e.Query
+	out.URL.Domain = e.Host
+
+	out.Client.Address = e.RemoteHost()
+	if net.ParseIP(out.Client.Address) != nil {
+		out.Client.IP = out.Client.Address
+	}
+
+	if len(e.UserAgent) > 0 {
+		out.UserAgent = &struct {
+			Original string `json:"original"`
+		}{e.UserAgent}
+	}
+	if len(e.User) > 0 {
+		out.User = &struct {
+			Name string `json:"name"`
+		}{e.User}
+	}
+	if len(e.Route) > 0 {
+		out.Labels = map[string]string{"route": e.Route}
+	}
+
+	line, err := json.Marshal(&out)
+	if err != nil {
+		line = []byte(fmt.Sprintf(`{"error":{"message":%q}}`, err.Error()))
+	}
+	return append(line, '\n')
+}
+
+type templateFormatter struct {
+	t *template.Template
+}
+
+// Template returns a Formatter which executes the text/template with
+// the *Entry, e.g.
+//
+//	{{.RemoteHost}} {{.Method}} {{.URI}} {{.Status}} {{.Duration}} {{.Request.Header.Get "X-Forwarded-For"}}
+//
+// A newline is appended, unless the template ends with one.
+func Template(text string) (Formatter, error) {
+	t, err := template.New("accessLog").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &templateFormatter{t: t}, nil
+}
+
+func (f *templateFormatter) Format(e *Entry) []byte {
+	var buf bytes.Buffer
+	if err := f.t.Execute(&buf, e); err != nil {
+		buf.Reset()
+		fmt.Fprintf(&buf, "accessLog: template error: %s", err)
+	}
+	if b := buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
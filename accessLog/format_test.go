@@ -0,0 +1,164 @@
+package accessLog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry() *Entry {
+	return &Entry{
+		Time:          time.Date(2026, time.October, 17, 13, 55, 36, 0, time.UTC),
+		Duration:      1500 * time.Millisecond,
+		RemoteAddr:    "10.0.0.1:4567",
+		User:          "frank",
+		Method:        "GET",
+		URI:           "/apache_pb.gif?a=1",
+		Path:          "/apache_pb.gif",
+		Query:         "a=1",
+		Proto:         "HTTP/1.0",
+		Host:          "example.com",
+		Status:        200,
+		Size:          2326,
+		Referer:       "http://www.example.com/start.html",
+		UserAgent:     `Mozilla/4.08 "quoted"`,
+		CorrelationID: "abc",
+		Route:         "/things/{id}",
+	}
+}
+
+func TestFormats(t *testing.T) {
+	template, err := Template("{{.RemoteHost}} {{.Status}} {{.Route}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		format Formatter
+		modify func(e *Entry)
+		want   string
+	}{
+		{
+			name:   "Common",
+			format: Common,
+			want:   "10.0.0.1 - frank [17/Oct/2026:13:55:36 +0000] \"GET /apache_pb.gif?a=1 HTTP/1.0\" 200 2326\n",
+		},
+		{
+			name:   "Common, anonymous & empty",
+			format: Common,
+			modify: func(e *Entry) { e.User, e.Size = "", 0 },
+			want:   "10.0.0.1 - - [17/Oct/2026:13:55:36 +0000] \"GET /apache_pb.gif?a=1 HTTP/1.0\" 200 -\n",
+		},
+		{
+			name:   "Common, escaped",
+			format: Common,
+			modify: func(e *Entry) { e.URI = "/a\"b\n" },
+			want:   "10.0.0.1 - frank [17/Oct/2026:13:55:36 +0000] \"GET /a\\\"b\\x0a HTTP/1.0\" 200 2326\n",
+		},
+		{
+			name:   "Combined",
+			format: Combined,
+			want: "10.0.0.1 - frank [17/Oct/2026:13:55:36 +0000] \"GET /apache_pb.gif?a=1 HTTP/1.0\" 200 2326" +
+				" \"http://www.example.com/start.html\" \"Mozilla/4.08 \\\"quoted\\\"\"\n",
+		},
+		{
+			name:   "W3C",
+			format: W3C,
+			want:   "2026-10-17 13:55:36 10.0.0.1 frank GET /apache_pb.gif a=1 200 2326 1.500 Mozilla/4.08+\"quoted\" http://www.example.com/start.html\n",
+		},
+		{
+			name:   "W3C, empty fields",
+			format: W3C,
+			modify: func(e *Entry) { e.User, e.Query, e.Referer = "", "", "" },
+			want:   "2026-10-17 13:55:36 10.0.0.1 - GET /apache_pb.gif - 200 2326 1.500 Mozilla/4.08+\"quoted\" -\n",
+		},
+		{
+			name:   "Template",
+			format: template,
+			want:   "10.0.0.1 200 /things/{id}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEntry()
+			if tt.modify != nil {
+				tt.modify(e)
+			}
+			if got := string(tt.format.Format(e)); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestECS(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(e *Entry)
+		want   map[string]interface{} // dotted paths
+	}{
+		{
+			name: "success",
+			want: map[string]interface{}{
+				"@timestamp":                "2026-10-17T13:55:36Z",
+				"event.outcome":             "success",
+				"event.duration":            float64(1500 * time.Millisecond),
+				"http.version":              "1.0",
+				"http.request.id":           "abc",
+				"http.response.status_code": float64(200),
+				"http.response.body.bytes":  float64(2326),
+				"url.path":                  "/apache_pb.gif",
+				"url.query":                 "a=1",
+				"client.ip":                 "10.0.0.1",
+				"user.name":                 "frank",
+				"user_agent.original":       `Mozilla/4.08 "quoted"`,
+				"labels.route":              "/things/{id}",
+			},
+		},
+		{
+			name:   "failure",
+			modify: func(e *Entry) { e.Status = 503 },
+			want:   map[string]interface{}{"event.outcome": "failure"},
+		},
+		{
+			name:   "anonymous, unix socket",
+			modify: func(e *Entry) { e.User, e.RemoteAddr, e.UserAgent = "", "@", "" },
+			want:   map[string]interface{}{"client.address": "@", "client.ip": nil, "user": nil, "user_agent": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEntry()
+			if tt.modify != nil {
+				tt.modify(e)
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(ECS.Format(e), &got); err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range tt.want {
+				if v := lookup(got, path); v != want {
+					t.Errorf("%s = %v, want %v", path, v, want)
+				}
+			}
+		})
+	}
+}
+
+// lookup returns the value at the dotted path, or nil
+func lookup(m map[string]interface{}, path string) interface{} {
+	var v interface{} = m
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
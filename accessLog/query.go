@@ -0,0 +1,56 @@
+package accessLog
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the value of a sensitive query parameter.
+const Redacted = "[REDACTED]"
+
+// SensitiveQueryParameters are the query parameters which commonly carry
+// credentials; their values are never logged by default.
+var SensitiveQueryParameters = []string{
+	"access_token", "api_key", "apikey", "code", "id_token", "key",
+	"password", "refresh_token", "secret", "signature", "sig", "token",
+}
+
+// QueryRedactor redacts the values of a set of query parameters, whose
+// names are matched without regard to case.
+type QueryRedactor map[string]bool
+
+// NewQueryRedactor returns a QueryRedactor for the named parameters.
+func NewQueryRedactor(names ...string) QueryRedactor {
+	q := make(QueryRedactor, len(names))
+	for _, name := range names {
+		q[strings.ToLower(name)] = true
+	}
+	return q
+}
+
+// Redact returns the raw query with the values of the parameters
+// replaced by Redacted.
+func (q QueryRedactor) Redact(rawQuery string) string {
+	if len(rawQuery) == 0 || len(q) == 0 {
+		return rawQuery
+	}
+
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		key := param
+		if j := strings.IndexByte(param, '='); j >= 0 {
+			key = param[:j]
+		}
+
+		name := key
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			name = unescaped
+		}
+
+		if q[strings.ToLower(name)] {
+			params[i] = key + "=" + Redacted
+		}
+	}
+
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,28 @@
+package accessLog
+
+import "testing"
+
+func TestQueryRedactor(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		query string
+		want  string
+	}{
+		{name: "empty query", names: SensitiveQueryParameters, query: "", want: ""},
+		{name: "no parameters", query: "token=abc", want: "token=abc"},
+		{name: "not sensitive", names: SensitiveQueryParameters, query: "a=1&b=2", want: "a=1&b=2"},
+		{name: "sensitive", names: SensitiveQueryParameters, query: "a=1&token=abc", want: "a=1&token=" + Redacted},
+		{name: "case", names: []string{"Token"}, query: "TOKEN=abc", want: "TOKEN=" + Redacted},
+		{name: "escaped name", names: []string{"api key"}, query: "api%20key=abc&x", want: "api%20key=" + Redacted + "&x"},
+		{name: "without a value", names: []string{"token"}, query: "token&a=1", want: "token=" + Redacted + "&a=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewQueryRedactor(tt.names...).Redact(tt.query); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
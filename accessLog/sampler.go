@@ -0,0 +1,197 @@
+package accessLog
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Rule selects a fraction of the requests it matches for logging.  A
+// request which matches no rule is always logged.
+type Rule struct {
+	Route       string  // route name or template; a trailing '*' matches any suffix; empty matches every route
+	StatusClass int     // 2 for 2xx, 3 for 3xx, & so on; zero matches every status
+	Rate        float64 // fraction, 0 to 1, of matching requests logged
+	PerSecond   float64 // if positive, log at most this many per second (a token bucket), rather than Rate
+	Burst       int     // token bucket size; at least 1
+}
+
+func (r *Rule) matches(route string, class int) bool {
+	if r.StatusClass != 0 && r.StatusClass != class {
+		return false
+	}
+
+	switch {
+	case len(r.Route) == 0:
+		return true
+	case strings.HasSuffix(r.Route, "*"):
+		return strings.HasPrefix(route, strings.TrimSuffix(r.Route, "*"))
+	}
+	return r.Route == route
+}
+
+// bucket is a token bucket, refilled at rate tokens per second
+type bucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type sampleRule struct {
+	Rule
+	bucket *bucket
+}
+
+// Sampler decides which completed requests are logged.  Errors & slow
+// requests are always logged; other requests are sampled by the first
+// Rule which matches them.
+type Sampler struct {
+	rules      []*sampleRule
+	minStatus  int
+	slow       time.Duration
+	metrics    *metrics.Config
+	sampledOut *prometheus.CounterVec
+}
+
+type SamplerOption func(*Sampler) error
+
+// NewSampler returns a Sampler which, by default, logs every request;
+// add rules with Sample.  Responses with a 5xx status are always logged.
+func NewSampler(opts ...SamplerOption) (*Sampler, error) {
+	s := &Sampler{
+		minStatus: 500,
+		metrics:   metrics.Default(),
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	// a second Sampler shares the counter already registered
+	c, err := s.metrics.Register(prometheus.NewCounterVec(
+		s.metrics.CounterOpts("access_log_sampled_out_total", "Number of request log lines discarded by sampling."),
+		[]string{"route", "class"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	s.sampledOut = c.(*prometheus.CounterVec)
+
+	return s, nil
+}
+
+// Sample adds rules, which are tried in order.
+func Sample(rules ...Rule) SamplerOption {
+	return func(s *Sampler) error {
+		now := time.Now()
+
+		for _, r := range rules {
+			if r.Rate < 0 || r.Rate > 1 {
+				return fmt.Errorf("accessLog.Sample requires a Rate between 0 and 1, not %g", r.Rate)
+			}
+			if r.StatusClass < 0 || r.StatusClass > 5 {
+				return fmt.Errorf("accessLog.Sample requires a StatusClass between 1 and 5, not %d", r.StatusClass)
+			}
+
+			sr := &sampleRule{Rule: r}
+			if r.PerSecond > 0 {
+				burst := float64(r.Burst)
+				if burst < 1 {
+					burst = 1
+				}
+				sr.bucket = &bucket{rate: r.PerSecond, burst: burst, tokens: burst, last: now}
+			}
+			s.rules = append(s.rules, sr)
+		}
+		return nil
+	}
+}
+
+// AlwaysLogStatus logs every response with at least the given status,
+// regardless of the rules; by default, 500.  Zero disables the override.
+func AlwaysLogStatus(status int) SamplerOption {
+	return func(s *Sampler) error {
+		s.minStatus = status
+		return nil
+	}
+}
+
+// AlwaysLogSlowerThan logs every request which takes longer than d,
+// regardless of the rules.
+func AlwaysLogSlowerThan(d time.Duration) SamplerOption {
+	return func(s *Sampler) error {
+		s.slow = d
+		return nil
+	}
+}
+
+// SamplerMetrics registers the sampled out counter per cfg; by default,
+// metrics.Default().
+func SamplerMetrics(cfg *metrics.Config) SamplerOption {
+	return func(s *Sampler) error {
+		if cfg == nil {
+			return fmt.Errorf("accessLog.SamplerMetrics requires a non-nil metrics.Config")
+		}
+		s.metrics = cfg
+		return nil
+	}
+}
+
+// Sampled reports whether the request should be logged, counting those
+// which should not.
+func (s *Sampler) Sampled(route string, status int, duration time.Duration) bool {
+	if s.minStatus > 0 && status >= s.minStatus {
+		return true
+	}
+	if s.slow > 0 && duration > s.slow {
+		return true
+	}
+
+	class := status / 100
+	for _, r := range s.rules {
+		if !r.matches(route, class) {
+			continue
+		}
+
+		var keep bool
+		if r.bucket != nil {
+			keep = r.bucket.take(time.Now())
+		} else {
+			keep = r.Rate >= 1 || rand.Float64() < r.Rate
+		}
+
+		if !keep {
+			s.sampledOut.With(prometheus.Labels{"route": route, "class": strconv.Itoa(class) + "xx"}).Inc()
+		}
+		return keep
+	}
+
+	return true
+}
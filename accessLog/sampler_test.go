@@ -0,0 +1,169 @@
+package accessLog
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBucket(t *testing.T) {
+	start := time.Now()
+	b := &bucket{rate: 2, burst: 2, tokens: 2, last: start}
+
+	tests := []struct {
+		after time.Duration
+		take  bool
+	}{
+		{after: 0, take: true},
+		{after: 0, take: true},
+		{after: 0, take: false},                      // the burst is spent
+		{after: 250 * time.Millisecond, take: false}, // half a token
+		{after: 500 * time.Millisecond, take: true},
+		{after: 500 * time.Millisecond, take: false},
+		{after: 10 * time.Second, take: true}, // refilled, up to the burst
+		{after: 10 * time.Second, take: true},
+		{after: 10 * time.Second, take: false},
+	}
+
+	for i, tt := range tests {
+		if take := b.take(start.Add(tt.after)); take != tt.take {
+			t.Errorf("%d: take() after %s = %t, want %t", i, tt.after, take, tt.take)
+		}
+	}
+}
+
+func TestSampled(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []SamplerOption
+		route      string
+		status     int
+		duration   time.Duration
+		want       []bool // for successive requests
+		sampledOut float64
+	}{
+		{name: "no rules", route: "/a", status: 200, want: []bool{true, true}},
+		{
+			name:       "sampled out",
+			opts:       []SamplerOption{Sample(Rule{Rate: 0})},
+			route:      "/a",
+			status:     200,
+			want:       []bool{false, false},
+			sampledOut: 2,
+		},
+		{name: "all sampled", opts: []SamplerOption{Sample(Rule{Rate: 1})}, route: "/a", status: 200, want: []bool{true, true}},
+		{name: "unmatched route", opts: []SamplerOption{Sample(Rule{Route: "/b", Rate: 0})}, route: "/a", status: 200, want: []bool{true}},
+		{
+			name:       "route prefix",
+			opts:       []SamplerOption{Sample(Rule{Route: "/things/*", Rate: 0})},
+			route:      "/things/{id}",
+			status:     200,
+			want:       []bool{false},
+			sampledOut: 1,
+		},
+		{name: "unmatched status class", opts: []SamplerOption{Sample(Rule{StatusClass: 2, Rate: 0})}, route: "/a", status: 404, want: []bool{true}},
+		{
+			name:       "first matching rule",
+			opts:       []SamplerOption{Sample(Rule{Route: "/a", Rate: 0}, Rule{Rate: 1})},
+			route:      "/a",
+			status:     200,
+			want:       []bool{false},
+			sampledOut: 1,
+		},
+		{name: "error", opts: []SamplerOption{Sample(Rule{Rate: 0})}, route: "/a", status: 503, want: []bool{true}},
+		{
+			name:   "AlwaysLogStatus",
+			opts:   []SamplerOption{Sample(Rule{Rate: 0}), AlwaysLogStatus(400)},
+			route:  "/a",
+			status: 404,
+			want:   []bool{true},
+		},
+		{
+			name:       "AlwaysLogStatus disabled",
+			opts:       []SamplerOption{Sample(Rule{Rate: 0}), AlwaysLogStatus(0)},
+			route:      "/a",
+			status:     503,
+			want:       []bool{false},
+			sampledOut: 1,
+		},
+		{
+			name:     "slow",
+			opts:     []SamplerOption{Sample(Rule{Rate: 0}), AlwaysLogSlowerThan(time.Second)},
+			route:    "/a",
+			status:   200,
+			duration: 2 * time.Second,
+			want:     []bool{true},
+		},
+		{
+			name:       "not slow",
+			opts:       []SamplerOption{Sample(Rule{Rate: 0}), AlwaysLogSlowerThan(time.Second)},
+			route:      "/a",
+			status:     200,
+			duration:   time.Second,
+			want:       []bool{false},
+			sampledOut: 1,
+		},
+		{
+			name:       "token bucket",
+			opts:       []SamplerOption{Sample(Rule{PerSecond: 0.001, Burst: 2})},
+			route:      "/a",
+			status:     200,
+			want:       []bool{true, true, false},
+			sampledOut: 1,
+		},
+		{
+			name:       "token bucket, burst at least 1",
+			opts:       []SamplerOption{Sample(Rule{PerSecond: 0.001})},
+			route:      "/a",
+			status:     200,
+			want:       []bool{true, false},
+			sampledOut: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc, err := metrics.New(metrics.Registry(prometheus.NewRegistry()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := NewSampler(append(tt.opts, SamplerMetrics(mc))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, want := range tt.want {
+				if got := s.Sampled(tt.route, tt.status, tt.duration); got != want {
+					t.Errorf("request %d: Sampled() = %t, want %t", i, got, want)
+				}
+			}
+
+			labels := prometheus.Labels{"route": tt.route, "class": strconv.Itoa(tt.status/100) + "xx"}
+			if got := testutil.ToFloat64(s.sampledOut.With(labels)); got != tt.sampledOut {
+				t.Errorf("access_log_sampled_out_total = %v, want %v", got, tt.sampledOut)
+			}
+		})
+	}
+}
+
+func TestNewSamplerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  SamplerOption
+	}{
+		{name: "negative rate", opt: Sample(Rule{Rate: -0.1})},
+		{name: "rate above 1", opt: Sample(Rule{Rate: 1.5})},
+		{name: "status class", opt: Sample(Rule{StatusClass: 6})},
+		{name: "nil metrics", opt: SamplerMetrics(nil)},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewSampler(tt.opt); err == nil {
+			t.Errorf("%s: NewSampler succeeded, want an error", tt.name)
+		}
+	}
+}
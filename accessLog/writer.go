@@ -0,0 +1,266 @@
+package accessLog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/logger"
+)
+
+var (
+	ErrClosed     = errors.New("accessLog: writer is closed")
+	ErrNoRotation = errors.New("accessLog: writer has no Rotator")
+)
+
+// Rotator returns the writer to use in place of current, e.g. a newly
+// (re)opened file after logrotate has moved the old one aside.
+type Rotator func(current io.Writer) (io.Writer, error)
+
+// RotateHook is called with the new writer after each rotation.
+type RotateHook func(w io.Writer) error
+
+// AsyncWriter queues writes & performs them, buffered, on a separate
+// goroutine, so that slow output never delays a request.  When the queue
+// is full, lines are dropped (and counted) rather than blocking.
+type AsyncWriter struct {
+	out           io.Writer
+	owned         bool // out was opened by us, so is closed by us
+	queueSize     int
+	flushInterval time.Duration
+	rotator       Rotator
+	signals       []os.Signal
+
+	mutex   sync.RWMutex // guards closed & hooks
+	closed  bool
+	hooks   []RotateHook
+	lines   chan []byte
+	rotate  chan chan error
+	done    chan struct{}
+	dropped uint64
+}
+
+type WriterOption func(*AsyncWriter)
+
+// QueueSize sets how many lines may be waiting to be written (default 4096).
+func QueueSize(n int) WriterOption {
+	return func(a *AsyncWriter) {
+		if n > 0 {
+			a.queueSize = n
+		}
+	}
+}
+
+// FlushInterval sets how often buffered lines are flushed (default 1s).
+func FlushInterval(d time.Duration) WriterOption {
+	return func(a *AsyncWriter) {
+		if d > 0 {
+			a.flushInterval = d
+		}
+	}
+}
+
+func WithRotator(r Rotator) WriterOption {
+	return func(a *AsyncWriter) { a.rotator = r }
+}
+
+// RotateOnSignal rotates the output whenever one of the signals (e.g.
+// syscall.SIGUSR1, as sent by logrotate's postrotate) is received.
+func RotateOnSignal(sigs ...os.Signal) WriterOption {
+	return func(a *AsyncWriter) { a.signals = append(a.signals, sigs...) }
+}
+
+// NewAsyncWriter starts writing to out; call Close to flush & stop.
+// Close does not close out.
+func NewAsyncWriter(out io.Writer, opts ...WriterOption) *AsyncWriter {
+	a := &AsyncWriter{
+		out:           out,
+		queueSize:     4096,
+		flushInterval: time.Duration(1) * time.Second,
+		rotate:        make(chan chan error),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.lines = make(chan []byte, a.queueSize)
+
+	go a.run()
+
+	return a
+}
+
+// OpenFile appends to the named file, reopening it when rotated.  Close
+// closes the file.
+func OpenFile(filename string, opts ...WriterOption) (*AsyncWriter, error) {
+	f, err := openFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	a := NewAsyncWriter(f, append([]WriterOption{WithRotator(Reopen(filename))}, opts...)...)
+	a.owned = true
+
+	return a, nil
+}
+
+// Reopen is a Rotator which closes the current file & opens filename,
+// for use when an external tool, such as logrotate, renames the log.
+func Reopen(filename string) Rotator {
+	return func(current io.Writer) (io.Writer, error) {
+		f, err := openFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := current.(io.Closer); ok && current != os.Stdout && current != os.Stderr {
+			c.Close()
+		}
+		return f, nil
+	}
+}
+
+func openFile(filename string) (*os.File, error) {
+	return os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+// OnRotate registers a hook to be called after each rotation.
+func (a *AsyncWriter) OnRotate(hook RotateHook) {
+	a.mutex.Lock()
+	a.hooks = append(a.hooks, hook)
+	a.mutex.Unlock()
+}
+
+// Write queues a copy of p.  It never blocks.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	if a.closed {
+		return 0, ErrClosed
+	}
+
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	select {
+	case a.lines <- line:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+
+	return len(p), nil
+}
+
+// Dropped returns the number of lines discarded because the queue was full.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Rotate flushes the output, replaces it using the Rotator & calls the
+// OnRotate hooks.
+func (a *AsyncWriter) Rotate() error {
+	a.mutex.RLock()
+	closed := a.closed
+	a.mutex.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	reply := make(chan error, 1)
+	select {
+	case a.rotate <- reply:
+		return <-reply
+	case <-a.done:
+		return ErrClosed
+	}
+}
+
+// Close writes any queued lines & stops the writer.
+func (a *AsyncWriter) Close() error {
+	a.mutex.Lock()
+	if a.closed {
+		a.mutex.Unlock()
+		return ErrClosed
+	}
+	a.closed = true
+	close(a.lines)
+	a.mutex.Unlock()
+
+	<-a.done
+
+	if c, ok := a.out.(io.Closer); ok && a.owned {
+		return c.Close()
+	}
+	return nil
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+
+	w := bufio.NewWriter(a.out)
+
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	var sigc chan os.Signal
+	if len(a.signals) > 0 {
+		sigc = make(chan os.Signal, 1)
+		signal.Notify(sigc, a.signals...)
+		defer signal.Stop(sigc)
+	}
+
+	for {
+		select {
+		case line, ok := <-a.lines:
+			if !ok {
+				w.Flush()
+				return
+			}
+			w.Write(line)
+
+		case <-ticker.C:
+			w.Flush()
+
+		case reply := <-a.rotate:
+			reply <- a.doRotate(w)
+
+		case <-sigc:
+			if err := a.doRotate(w); err != nil {
+				logger.Default().Error("unable to rotate the access log", logger.Err(err))
+			}
+		}
+	}
+}
+
+func (a *AsyncWriter) doRotate(w *bufio.Writer) error {
+	w.Flush()
+
+	if a.rotator == nil {
+		return ErrNoRotation
+	}
+
+	out, err := a.rotator(a.out)
+	if err != nil {
+		return err
+	}
+	a.out = out
+	w.Reset(out)
+
+	a.mutex.RLock()
+	hooks := a.hooks
+	a.mutex.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(w); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+
+	return nil
+}
@@ -12,8 +12,9 @@ import (
 	"sort"
 	"sync"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/golang/gddo/httputil/header"
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/route"
 )
 
 type ActuatorMux struct {
@@ -89,8 +90,13 @@ func (m *ActuatorMux) Handler(r *http.Request) (h http.Handler, pattern string)
 
 func (m *ActuatorMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if m.mappingURL == r.URL.Path {
+		route.Set(r.Context(), m.mappingURL)
 		m.displayEndpoints(w, r)
 	} else {
+		// record the matched pattern, for metrics & logs
+		if _, pattern := m.ServeMux.Handler(r); len(pattern) > 0 {
+			route.Set(r.Context(), pattern)
+		}
 		m.ServeMux.ServeHTTP(w, r)
 	}
 }
@@ -113,7 +119,9 @@ func (m *ActuatorMux) displayEndpoints(w http.ResponseWriter, r *http.Request) {
 
 	hostname, err := os.Hostname()
 	if err != nil {
-		log.Fatal(err)
+		logger.Default().Error("unable to obtain hostname", logger.Err(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
 	}
 
 	responseType := "text/text"
@@ -121,7 +129,7 @@ func (m *ActuatorMux) displayEndpoints(w http.ResponseWriter, r *http.Request) {
 
 	specs := header.ParseAccept(r.Header, "Accept")
 	for _, spec := range specs {
-		log.Debugf("spec Q: %f, type: %s", spec.Q, spec.Value)
+		logger.Default().Debug("accept spec", logger.Float64("Q", spec.Q), logger.String("type", spec.Value))
 		if spec.Q == 1.0 && spec.Value == "application/xml" {
 			responseType = "application/xml"
 			break
@@ -153,7 +161,7 @@ func (m *ActuatorMux) displayEndpoints(w http.ResponseWriter, r *http.Request) {
 			Handler:  "actuator.displayEndpoints",
 			Mappings: m.mappings})
 		if err != nil {
-			log.WithError(err).Error("Unable to execute template")
+			logger.Default().Error("Unable to execute template", logger.Err(err))
 		}
 	} else {
 		type response struct {
@@ -173,7 +181,9 @@ func (m *ActuatorMux) displayEndpoints(w http.ResponseWriter, r *http.Request) {
 			out, err = xml.Marshal(siteMap)
 		}
 		if err != nil {
-			log.WithError(err).Fatal("unable to marshal site map")
+			logger.Default().Error("unable to marshal site map", logger.Err(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
 		}
 		w.Write(out)
 	}
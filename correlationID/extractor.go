@@ -0,0 +1,274 @@
+package correlationID
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const defaultMaxLength = 128
+
+// Validator reports whether an inbound correlation ID is acceptable.
+type Validator func(string) bool
+
+// Extractor determines the correlation ID of an inbound request: which
+// headers it is read from, whether it is trusted & how replacements
+// are generated.
+type Extractor struct {
+	headers   []string
+	validator Validator
+	maxLength int
+	trusted   []*net.IPNet
+	generator Generator
+}
+
+type Option func(*Extractor) error
+
+var (
+	defaultMutex        sync.RWMutex
+	defaultExtractor, _ = NewExtractor()
+)
+
+// Default returns the Extractor used by the package level functions.
+func Default() *Extractor {
+	defaultMutex.RLock()
+	defer defaultMutex.RUnlock()
+
+	return defaultExtractor
+}
+
+// SetDefault replaces the Extractor used by the package level functions,
+// e.g. the client & server interceptors, which look up Default() on every
+// call rather than when they are built.  It is safe to call concurrently,
+// though requests in flight may have been tagged by the previous Extractor.
+func SetDefault(e *Extractor) {
+	if e == nil {
+		return
+	}
+
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+
+	defaultExtractor = e
+}
+
+// NewExtractor returns an Extractor which, by default, trusts an
+// X-Request-Id from anyone, provided it passes ValidID, & mints UUIDv4s.
+func NewExtractor(opts ...Option) (*Extractor, error) {
+	e := &Extractor{
+		headers:   []string{CORRID},
+		validator: ValidID,
+		maxLength: defaultMaxLength,
+		generator: NewUUIDv4,
+	}
+
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Headers sets the headers (or gRPC metadata keys) searched, in order,
+// for an inbound ID.  The first header which is neither TRACEPARENT nor
+// B3TRACEID is also used to return generated IDs to the caller.
+func Headers(names ...string) Option {
+	return func(e *Extractor) error {
+		if len(names) == 0 {
+			return fmt.Errorf("correlationID.Headers requires at least one header name")
+		}
+		e.headers = names
+		return nil
+	}
+}
+
+// MaxLength sets the longest inbound ID accepted (default 128).
+func MaxLength(n int) Option {
+	return func(e *Extractor) error {
+		if n <= 0 {
+			return fmt.Errorf("correlationID.MaxLength must be positive, not %d", n)
+		}
+		e.maxLength = n
+		return nil
+	}
+}
+
+// TrustedCIDRs only accepts inbound IDs from peers within the given
+// networks; requests from anywhere else are assigned a new ID.
+func TrustedCIDRs(cidrs ...string) Option {
+	return func(e *Extractor) error {
+		for _, cidr := range cidrs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("correlationID.TrustedCIDRs: %s", err)
+			}
+			e.trusted = append(e.trusted, network)
+		}
+		return nil
+	}
+}
+
+// WithGenerator sets how IDs are minted (default NewUUIDv4); see also
+// NewUUIDv7, NewULID & TraceID.
+func WithGenerator(g Generator) Option {
+	return func(e *Extractor) error {
+		if g == nil {
+			return fmt.Errorf("correlationID.WithGenerator requires a non-nil Generator")
+		}
+		e.generator = g
+		return nil
+	}
+}
+
+func WithValidator(v Validator) Option {
+	return func(e *Extractor) error {
+		if v == nil {
+			return fmt.Errorf("correlationID.WithValidator requires a non-nil Validator")
+		}
+		e.validator = v
+		return nil
+	}
+}
+
+// ValidID accepts IDs made up of letters, digits, '-', '_', '.' and ':'.
+// This covers UUIDs, ULIDs & trace IDs while keeping IDs safe to log.
+func ValidID(id string) bool {
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return len(id) > 0
+}
+
+// Header returns the header used to return an ID to the caller.
+func (e *Extractor) Header() string {
+	for _, name := range e.headers {
+		if !isTraceHeader(name) {
+			return name
+		}
+	}
+	return CORRID
+}
+
+// Generate returns a new ID for the request whose context is ctx.
+func (e *Extractor) Generate(ctx context.Context) string {
+	return e.generator(ctx)
+}
+
+// FromRequest returns the request, tagged with its correlation ID, the
+// ID & whether it came from the caller (or an earlier middleware).
+func (e *Extractor) FromRequest(req *http.Request) (*http.Request, string, bool) {
+	if corrID := FromContext(req.Context()); len(corrID) > 0 {
+		return req, corrID, true
+	}
+
+	corrID, fExisted := e.resolve(req.Context(), req.RemoteAddr, req.Header.Get)
+	req = req.WithContext(NewContext(req.Context(), corrID))
+
+	return req, corrID, fExisted
+}
+
+// FromIncomingContext is FromRequest for gRPC: the correlation ID is
+// taken from the incoming metadata.
+func (e *Extractor) FromIncomingContext(ctx context.Context) (context.Context, string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+
+	corrID, fExisted := e.resolve(ctx, remoteAddr, func(key string) string {
+		if values := md[strings.ToLower(key)]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	})
+
+	return NewContext(ctx, corrID), corrID, fExisted
+}
+
+// resolve returns the first valid ID found by lookup, provided the peer
+// is trusted, otherwise a newly generated one
+func (e *Extractor) resolve(ctx context.Context, remoteAddr string, lookup func(string) string) (string, bool) {
+	if e.trustedPeer(remoteAddr) {
+		for _, name := range e.headers {
+			corrID := lookup(name)
+			switch {
+			case strings.EqualFold(name, TRACEPARENT):
+				corrID = traceIDFromTraceparent(corrID)
+			case strings.EqualFold(name, B3TRACEID):
+				corrID = strings.ToLower(corrID)
+			}
+
+			if e.valid(corrID) {
+				return corrID, true
+			}
+		}
+	}
+
+	return e.generator(ctx), false
+}
+
+func (e *Extractor) valid(corrID string) bool {
+	return len(corrID) > 0 && len(corrID) <= e.maxLength && e.validator(corrID)
+}
+
+func (e *Extractor) trustedPeer(remoteAddr string) bool {
+	if len(e.trusted) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range e.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTraceHeader(name string) bool {
+	return strings.EqualFold(name, TRACEPARENT) || strings.EqualFold(name, B3TRACEID)
+}
+
+// traceIDFromTraceparent returns the trace-id field of a W3C traceparent
+// header (version-traceid-parentid-flags), or "" if it is malformed
+func traceIDFromTraceparent(traceparent string) string {
+	fields := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || len(fields[1]) != 32 {
+		return ""
+	}
+
+	traceID := strings.ToLower(fields[1])
+	if strings.Trim(traceID, "0") == "" {
+		return ""
+	}
+	for _, c := range traceID {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return ""
+		}
+	}
+
+	return traceID
+}
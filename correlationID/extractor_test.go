@@ -0,0 +1,282 @@
+package correlationID
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// generated is the ID minted by the test extractors
+const generated = "generated"
+
+func fixed(context.Context) string { return generated }
+
+func TestExtractorFromRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		remoteAddr string
+		header     http.Header
+		want       string
+		existed    bool
+	}{
+		{name: "no ID", want: generated},
+		{
+			name:    "valid ID",
+			header:  http.Header{CORRID: {"abc-123"}},
+			want:    "abc-123",
+			existed: true,
+		},
+		{
+			name:   "invalid characters",
+			header: http.Header{CORRID: {"abc\n123"}},
+			want:   generated,
+		},
+		{
+			name:   "too long",
+			opts:   []Option{MaxLength(4)},
+			header: http.Header{CORRID: {"abcde"}},
+			want:   generated,
+		},
+		{
+			name:   "custom validator",
+			opts:   []Option{WithValidator(func(id string) bool { return strings.HasPrefix(id, "ok-") })},
+			header: http.Header{CORRID: {"abc"}},
+			want:   generated,
+		},
+		{
+			name:       "trusted peer",
+			opts:       []Option{TrustedCIDRs("10.0.0.0/8", "fd00::/8")},
+			remoteAddr: "10.1.2.3:4567",
+			header:     http.Header{CORRID: {"abc"}},
+			want:       "abc",
+			existed:    true,
+		},
+		{
+			name:       "trusted IPv6 peer",
+			opts:       []Option{TrustedCIDRs("10.0.0.0/8", "fd00::/8")},
+			remoteAddr: "[fd00::1]:4567",
+			header:     http.Header{CORRID: {"abc"}},
+			want:       "abc",
+			existed:    true,
+		},
+		{
+			name:       "untrusted peer",
+			opts:       []Option{TrustedCIDRs("10.0.0.0/8")},
+			remoteAddr: "192.168.1.1:4567",
+			header:     http.Header{CORRID: {"abc"}},
+			want:       generated,
+		},
+		{
+			name:       "unparseable peer",
+			opts:       []Option{TrustedCIDRs("10.0.0.0/8")},
+			remoteAddr: "pipe",
+			header:     http.Header{CORRID: {"abc"}},
+			want:       generated,
+		},
+		{
+			name:    "headers searched in order",
+			opts:    []Option{Headers(XCORRID, CORRID)},
+			header:  http.Header{CORRID: {"second"}, XCORRID: {"first"}},
+			want:    "first",
+			existed: true,
+		},
+		{
+			name:    "invalid header skipped",
+			opts:    []Option{Headers(XCORRID, CORRID)},
+			header:  http.Header{CORRID: {"second"}, XCORRID: {"bad id"}},
+			want:    "second",
+			existed: true,
+		},
+		{
+			name:    "traceparent",
+			opts:    []Option{Headers(TRACEPARENT, CORRID)},
+			header:  http.Header{"Traceparent": {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}},
+			want:    "4bf92f3577b34da6a3ce929d0e0e4736",
+			existed: true,
+		},
+		{
+			name:   "malformed traceparent",
+			opts:   []Option{Headers(TRACEPARENT)},
+			header: http.Header{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}},
+			want:   generated,
+		},
+		{
+			name:    "B3",
+			opts:    []Option{Headers(B3TRACEID)},
+			header:  http.Header{B3TRACEID: {"80F198EE56343BA8"}},
+			want:    "80f198ee56343ba8",
+			existed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewExtractor(append([]Option{WithGenerator(fixed)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.remoteAddr) > 0 {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			for k, v := range tt.header {
+				r.Header[http.CanonicalHeaderKey(k)] = v
+			}
+
+			r, id, existed := e.FromRequest(r)
+			if id != tt.want || existed != tt.existed {
+				t.Errorf("FromRequest = %q, %t, want %q, %t", id, existed, tt.want, tt.existed)
+			}
+			if got := FromContext(r.Context()); got != id {
+				t.Errorf("FromContext = %q, want %q", got, id)
+			}
+
+			// once tagged, the ID is not resolved again
+			if _, again, existed := e.FromRequest(r); again != id || !existed {
+				t.Errorf("FromRequest of a tagged request = %q, %t, want %q, true", again, existed, id)
+			}
+		})
+	}
+}
+
+func TestNewExtractorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{name: "no headers", opt: Headers()},
+		{name: "zero length", opt: MaxLength(0)},
+		{name: "bad CIDR", opt: TrustedCIDRs("10.0.0.0/33")},
+		{name: "nil generator", opt: WithGenerator(nil)},
+		{name: "nil validator", opt: WithValidator(nil)},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewExtractor(tt.opt); err == nil {
+			t.Errorf("%s: NewExtractor succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestExtractorHeader(t *testing.T) {
+	tests := []struct {
+		headers []string
+		want    string
+	}{
+		{headers: []string{CORRID}, want: CORRID},
+		{headers: []string{TRACEPARENT, B3TRACEID, XCORRID}, want: XCORRID},
+		{headers: []string{TRACEPARENT}, want: CORRID},
+	}
+
+	for _, tt := range tests {
+		e, err := NewExtractor(Headers(tt.headers...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.Header(); got != tt.want {
+			t.Errorf("Header() with %v = %q, want %q", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestExtractorFromIncomingContext(t *testing.T) {
+	e, err := NewExtractor(Headers(XCORRID), TrustedCIDRs("10.0.0.0/8"), WithGenerator(fixed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		md      metadata.MD
+		peer    string
+		want    string
+		existed bool
+	}{
+		{name: "trusted", md: metadata.Pairs("x-correlation-id", "abc"), peer: "10.0.0.1", want: "abc", existed: true},
+		{name: "untrusted", md: metadata.Pairs("x-correlation-id", "abc"), peer: "192.168.0.1", want: generated},
+		{name: "no metadata", peer: "10.0.0.1", want: generated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(tt.peer), Port: 4567}})
+
+			ctx, id, existed := e.FromIncomingContext(ctx)
+			if id != tt.want || existed != tt.existed {
+				t.Errorf("FromIncomingContext = %q, %t, want %q, %t", id, existed, tt.want, tt.existed)
+			}
+			if got := FromContext(ctx); got != id {
+				t.Errorf("FromContext = %q, want %q", got, id)
+			}
+		})
+	}
+}
+
+func TestClientInterceptorsUseDefault(t *testing.T) {
+	before := Default()
+	defer SetDefault(before)
+
+	e, err := NewExtractor(Headers(XCORRID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		set      *Extractor
+		outgoing metadata.MD
+		want     metadata.MD
+	}{
+		{name: "default", set: before, want: metadata.Pairs("x-request-id", "abc")},
+		{name: "set default", set: e, want: metadata.Pairs("x-correlation-id", "abc")},
+		{
+			name:     "explicitly set by the caller",
+			set:      e,
+			outgoing: metadata.Pairs("x-correlation-id", "mine"),
+			want:     metadata.Pairs("x-correlation-id", "mine"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDefault(tt.set)
+
+			ctx := NewContext(context.Background(), "abc")
+			if tt.outgoing != nil {
+				ctx = metadata.NewOutgoingContext(ctx, tt.outgoing)
+			}
+
+			var got metadata.MD
+			err := UnaryClientInterceptor()(ctx, "/svc/Method", nil, nil, nil,
+				func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+					got, _ = metadata.FromOutgoingContext(ctx)
+					return nil
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("metadata = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if len(got[k]) != 1 || got[k][0] != v[0] {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package correlationID
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	mrand "math/rand"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opentracing/opentracing-go"
+)
+
+// Generator mints a new correlation ID for a request which did not
+// arrive with a (trusted, valid) one.  ctx is the request's context,
+// so generators may derive the ID from, e.g., the active span.
+type Generator func(ctx context.Context) string
+
+// crockford is the base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// carrier keys which hold the trace ID, by tracer
+var traceIDKeys = []string{"x-b3-traceid", "ot-tracer-traceid"}
+
+// NewUUIDv4 returns a random UUID; this is the default generator.
+func NewUUIDv4(context.Context) string {
+	var id uuid.UUID
+
+	random(id[:])
+	id[6] = (id[6] & 0x0f) | 0x40 // version 4
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return id.String()
+}
+
+// NewUUIDv7 returns a UUID whose leading 48 bits are the current
+// Unix time in milliseconds, so that IDs sort by creation time.
+func NewUUIDv7(context.Context) string {
+	var id uuid.UUID
+
+	timestamped(id[:])
+	id[6] = (id[6] & 0x0f) | 0x70 // version 7
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return id.String()
+}
+
+// NewULID returns a 26 character, lexicographically sortable identifier
+// (see https://github.com/ulid/spec).
+func NewULID(context.Context) string {
+	var id [16]byte
+
+	timestamped(id[:])
+
+	// 128 bits encode as 26 base32 characters, the first of
+	// which carries just three bits (i.e. two leading zero bits)
+	out := make([]byte, 26)
+	for i := range out {
+		var v byte
+		for j := 0; j < 5; j++ {
+			bit := i*5 + j - 2
+			v <<= 1
+			if bit >= 0 && id[bit/8]&(0x80>>uint(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockford[v]
+	}
+
+	return string(out)
+}
+
+// TraceID returns a Generator which uses the trace ID of the span active
+// in the request's context, so that logs & traces share an ID.  Requests
+// without a span, or whose tracer does not expose its trace ID, are
+// assigned an ID by otherwise.  The tracing middleware must run before
+// the correlation ID is resolved for a span to be found.
+func TraceID(otherwise Generator) Generator {
+	if otherwise == nil {
+		otherwise = NewUUIDv4
+	}
+
+	return func(ctx context.Context) string {
+		if traceID := spanTraceID(ctx); ValidID(traceID) {
+			return traceID
+		}
+		return otherwise(ctx)
+	}
+}
+
+// spanTraceID returns the trace ID of the active span, obtained by
+// injecting its context into a text map; OpenTracing has no tracer
+// neutral accessor
+func spanTraceID(ctx context.Context) string {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		return ""
+	}
+
+	for k, v := range carrier {
+		for _, want := range traceIDKeys {
+			if strings.EqualFold(k, want) {
+				return strings.ToLower(v)
+			}
+		}
+	}
+	return ""
+}
+
+// timestamped fills b (at least 6 bytes) with the current time in
+// milliseconds, big endian, followed by random bytes
+func timestamped(b []byte) {
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(b[:6], ms[2:])
+
+	random(b[6:])
+}
+
+// random fills b with random bytes, falling back to math/rand should
+// the system's source fail: correlation IDs need to be unique, not
+// unpredictable, so failing the request would be worse
+func random(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		for i := range b {
+			b[i] = byte(mrand.Intn(256))
+		}
+	}
+}
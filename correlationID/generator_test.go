@@ -0,0 +1,124 @@
+package correlationID
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		name     string
+		generate Generator
+		length   int
+		version  uuid.Version // 0 for non-UUIDs
+		sorted   bool
+	}{
+		{name: "UUIDv4", generate: NewUUIDv4, length: 36, version: 4},
+		{name: "UUIDv7", generate: NewUUIDv7, length: 36, version: 7, sorted: true},
+		{name: "ULID", generate: NewULID, length: 26, sorted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var previous string
+			seen := make(map[string]bool)
+			for i := 0; i < 5; i++ {
+				id := tt.generate(ctx)
+
+				if len(id) != tt.length || !ValidID(id) {
+					t.Errorf("%q is not a valid %s", id, tt.name)
+				}
+				if tt.version != 0 {
+					u, err := uuid.Parse(id)
+					if err != nil || u.Version() != tt.version || u.Variant() != uuid.RFC4122 {
+						t.Errorf("%q is not a version %d UUID", id, tt.version)
+					}
+				} else if strings.Trim(id, crockford) != "" || id[0] > '7' {
+					t.Errorf("%q is not a ULID", id)
+				}
+
+				if seen[id] {
+					t.Errorf("%q was generated twice", id)
+				}
+				seen[id] = true
+
+				// IDs minted in later milliseconds sort later
+				if tt.sorted && id <= previous {
+					t.Errorf("%q does not sort after %q", id, previous)
+				}
+				previous = id
+				time.Sleep(2 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestULIDTimestamp(t *testing.T) {
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	id := NewULID(context.Background())
+
+	// the first 10 characters encode the 48 bit timestamp
+	var ms int64
+	for _, c := range id[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+	}
+	if ms < before || ms > before+1000 {
+		t.Errorf("%q encodes %d ms, want about %d", id, ms, before)
+	}
+}
+
+// b3Injector injects a mock span's trace ID as zipkin's tracer does
+type b3Injector struct{}
+
+func (b3Injector) Inject(sc mocktracer.MockSpanContext, carrier interface{}) error {
+	carrier.(opentracing.TextMapWriter).Set("X-B3-TraceId", fmt.Sprintf("%016X", sc.TraceID))
+	return nil
+}
+
+func TestTraceID(t *testing.T) {
+	b3 := mocktracer.New()
+	b3.RegisterInjector(opentracing.TextMap, b3Injector{})
+	b3Span := b3.StartSpan("b3")
+
+	// the mock tracer's own carrier keys are unknown
+	mockSpan := mocktracer.New().StartSpan("mock")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "no span", ctx: context.Background(), want: generated},
+		{name: "unknown tracer", ctx: opentracing.ContextWithSpan(context.Background(), mockSpan), want: generated},
+		{
+			name: "B3",
+			ctx:  opentracing.ContextWithSpan(context.Background(), b3Span),
+			want: fmt.Sprintf("%016x", b3Span.Context().(mocktracer.MockSpanContext).TraceID),
+		},
+	}
+
+	generate := TraceID(fixed)
+	for _, tt := range tests {
+		if got := generate(tt.ctx); got != tt.want {
+			t.Errorf("%s: TraceID = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// the ID is resolved once the span is active
+	e, err := NewExtractor(WithGenerator(TraceID(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Generate(tests[2].ctx); got != tests[2].want {
+		t.Errorf("Generate = %q, want %q", got, tests[2].want)
+	}
+}
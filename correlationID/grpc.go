@@ -0,0 +1,154 @@
+package correlationID
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mwitkow/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// NewContext returns a copy of ctx carrying the correlation ID.
+func NewContext(ctx context.Context, corrID string) context.Context {
+	return context.WithValue(ctx, correlationID, corrID)
+}
+
+// FromIncomingContext is FromRequest for gRPC, using the Default Extractor:
+// the correlation ID is taken from the incoming metadata, or generated if
+// the caller did not send a trusted, valid one.
+func FromIncomingContext(ctx context.Context) (context.Context, string, bool) {
+	return Default().FromIncomingContext(ctx)
+}
+
+// UnaryServerInterceptor tags each unary RPC's context with a correlation ID,
+// using the Default Extractor.  Like the client interceptors, it looks up
+// Default() on every call, so it follows a later SetDefault.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		return Default().UnaryServerInterceptor()(ctx, req, info, handler)
+	}
+}
+
+// StreamServerInterceptor tags each streaming RPC's context with a correlation ID,
+// using the Default Extractor, which is looked up on every call.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		return Default().StreamServerInterceptor()(srv, stream, info, handler)
+	}
+}
+
+// UnaryServerInterceptor tags each unary RPC's context with a correlation ID.
+// A generated ID is returned to the caller in the response trailers.
+func (e *Extractor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, corrID, fExisted := e.FromIncomingContext(ctx)
+
+		// if we're at the edge of the system, send the correlation ID back to the caller
+		if !fExisted {
+			grpc.SetTrailer(ctx, metadata.Pairs(e.metadataKey(), corrID))
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor tags each streaming RPC's context with a correlation ID.
+// A generated ID is returned to the caller in the response trailers.
+func (e *Extractor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		ctx, corrID, fExisted := e.FromIncomingContext(stream.Context())
+		if !fExisted {
+			stream.SetTrailer(metadata.Pairs(e.metadataKey(), corrID))
+		}
+
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+// metadataKey is Header as a gRPC metadata key, which are always lower case
+func (e *Extractor) metadataKey() string {
+	return strings.ToLower(e.Header())
+}
+
+// outgoingContext adds the correlation ID held by ctx, if any, to the
+// outgoing metadata, unless the caller has already set one explicitly
+func (e *Extractor) outgoingContext(ctx context.Context) context.Context {
+	corrID := FromContext(ctx)
+	if len(corrID) == 0 {
+		return ctx
+	}
+	key := e.metadataKey()
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md[key]) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, key, corrID)
+}
+
+// UnaryClientInterceptor propagates the correlation ID found in the
+// context (see FromRequest & FromIncomingContext) to the server, using
+// the Default Extractor's header.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+		return Default().UnaryClientInterceptor()(ctx, method, req, reply, cc, invoker, opts...)
+	}
+}
+
+// StreamClientInterceptor propagates the correlation ID found in the
+// context to the server when a stream is opened, using the Default
+// Extractor's header.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return Default().StreamClientInterceptor()(ctx, desc, cc, method, streamer, opts...)
+	}
+}
+
+// UnaryClientInterceptor propagates the correlation ID found in the
+// context to the server, in the Extractor's header.
+func (e *Extractor) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+		return invoker(e.outgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor propagates the correlation ID found in the
+// context to the server when a stream is opened, in the Extractor's header.
+func (e *Extractor) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(e.outgoingContext(ctx), desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,162 @@
+package correlationID
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// transportStream records the trailer set by the unary interceptor
+type transportStream struct {
+	trailer metadata.MD
+}
+
+func (s *transportStream) Method() string               { return "/svc/Method" }
+func (s *transportStream) SetHeader(metadata.MD) error  { return nil }
+func (s *transportStream) SendHeader(metadata.MD) error { return nil }
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+// serverStream records the trailer set by the stream interceptor
+type serverStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	trailer metadata.MD
+}
+
+func (s *serverStream) Context() context.Context  { return s.ctx }
+func (s *serverStream) SetTrailer(md metadata.MD) { s.trailer = metadata.Join(s.trailer, md) }
+
+func TestServerInterceptors(t *testing.T) {
+	e, err := NewExtractor(Headers(XCORRID), TrustedCIDRs("10.0.0.0/8"), WithGenerator(fixed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		md      metadata.MD
+		peer    string
+		want    string
+		trailer metadata.MD // returned to the caller
+	}{
+		{name: "trusted", md: metadata.Pairs("x-correlation-id", "abc"), peer: "10.0.0.1", want: "abc"},
+		{
+			name:    "untrusted",
+			md:      metadata.Pairs("x-correlation-id", "abc"),
+			peer:    "192.168.0.1",
+			want:    generated,
+			trailer: metadata.Pairs("x-correlation-id", generated),
+		},
+		{name: "no metadata", peer: "10.0.0.1", want: generated, trailer: metadata.Pairs("x-correlation-id", generated)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(tt.peer), Port: 4567}})
+
+			t.Run("unary", func(t *testing.T) {
+				stream := &transportStream{}
+				var got string
+				_, err := e.UnaryServerInterceptor()(grpc.NewContextWithServerTransportStream(ctx, stream), nil,
+					&grpc.UnaryServerInfo{FullMethod: "/svc/Method"},
+					func(ctx context.Context, req interface{}) (interface{}, error) {
+						got = FromContext(ctx)
+						return nil, nil
+					})
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkTagged(t, got, stream.trailer, tt.want, tt.trailer)
+			})
+
+			t.Run("stream", func(t *testing.T) {
+				stream := &serverStream{ctx: ctx}
+				var got string
+				err := e.StreamServerInterceptor()(nil, stream, &grpc.StreamServerInfo{FullMethod: "/svc/Method"},
+					func(srv interface{}, stream grpc.ServerStream) error {
+						got = FromContext(stream.Context())
+						return nil
+					})
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkTagged(t, got, stream.trailer, tt.want, tt.trailer)
+			})
+		})
+	}
+}
+
+func TestServerInterceptorsUseDefault(t *testing.T) {
+	before := Default()
+	defer SetDefault(before)
+
+	// built before SetDefault is called
+	unary, stream := UnaryServerInterceptor(), StreamServerInterceptor()
+
+	e, err := NewExtractor(Headers(XCORRID), WithGenerator(fixed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		set     *Extractor
+		trailer string // key of the generated ID
+	}{
+		{name: "default", set: before, trailer: "x-request-id"},
+		{name: "set default", set: e, trailer: "x-correlation-id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetDefault(tt.set)
+
+			ts := &transportStream{}
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), ts)
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Method"},
+				func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ts.trailer[tt.trailer]) != 1 {
+				t.Errorf("unary trailer = %v, want %s", ts.trailer, tt.trailer)
+			}
+
+			ss := &serverStream{ctx: context.Background()}
+			err = stream(nil, ss, &grpc.StreamServerInfo{FullMethod: "/svc/Method"},
+				func(srv interface{}, stream grpc.ServerStream) error { return nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ss.trailer[tt.trailer]) != 1 {
+				t.Errorf("stream trailer = %v, want %s", ss.trailer, tt.trailer)
+			}
+		})
+	}
+}
+
+// checkTagged compares the ID seen by the handler & the trailer with those wanted
+func checkTagged(t *testing.T, got string, trailer metadata.MD, want string, wantTrailer metadata.MD) {
+	if got != want {
+		t.Errorf("handler's correlation ID = %q, want %q", got, want)
+	}
+	if len(trailer) != len(wantTrailer) {
+		t.Fatalf("trailer = %v, want %v", trailer, wantTrailer)
+	}
+	for k, v := range wantTrailer {
+		if len(trailer[k]) != 1 || trailer[k][0] != v[0] {
+			t.Errorf("trailer = %v, want %v", trailer, wantTrailer)
+		}
+	}
+}
@@ -3,12 +3,13 @@ package correlationID
 import (
 	"context"
 	"net/http"
-
-	"github.com/google/uuid"
 )
 
 const (
-	CORRID string = "X-Request-Id"
+	CORRID      string = "X-Request-Id"
+	XCORRID     string = "X-Correlation-Id"
+	TRACEPARENT string = "traceparent"  // W3C trace context; the trace ID is used
+	B3TRACEID   string = "X-B3-TraceId" // zipkin B3 propagation; the trace ID is used
 )
 
 var (
@@ -17,19 +18,11 @@ var (
 
 type key struct{}
 
+// FromRequest tags the request with a correlation ID using the Default
+// Extractor.  It returns the tagged request, the ID and whether the ID
+// was supplied by the caller.
 func FromRequest(req *http.Request) (*http.Request, string, bool) {
-	fExisted := false
-
-	corrID := req.Header.Get(CORRID)
-	if len(corrID) == 0 {
-		corrID = uuid.New().String()
-	} else {
-		fExisted = true
-	}
-	ctx := context.WithValue(req.Context(), correlationID, corrID)
-	req = req.WithContext(ctx)
-
-	return req, corrID, fExisted
+	return Default().FromRequest(req)
 }
 
 func FromContext(ctx context.Context) string {
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mchudgins/go-service-helper/accessLog"
+)
+
+// Redacted replaces the value of a sensitive header or query parameter.
+const Redacted = accessLog.Redacted
+
+// HeaderPolicy determines which request headers, and how much of them,
+// NewHTTPLogger writes to the log.  Redaction wins over hashing, which
+// wins over the allow-list.
+type HeaderPolicy struct {
+	Allow          []string // if not empty, only these headers are logged
+	Redact         []string // headers logged as Redacted
+	RedactPatterns []string // headers whose (lower case) names contain any of these are logged as Redacted
+	Hash           []string // headers logged as a hash, so requests may be correlated without logging the identifier
+	HashKey        []byte   // if present, hashes are HMAC-SHA256 rather than SHA256
+	RedactQuery    []string // query parameters whose values are logged as Redacted
+	MaxFieldLength int      // if positive, longer values are truncated
+}
+
+// DefaultHeaderPolicy never logs credentials: authorization headers,
+// cookies, API keys, tokens & the like are redacted, as are common
+// credential bearing query parameters.  Values are limited to 256 bytes.
+func DefaultHeaderPolicy() HeaderPolicy {
+	return HeaderPolicy{
+		Redact: []string{
+			"Authorization",
+			"Proxy-Authorization",
+			"Cookie",
+			"Set-Cookie",
+		},
+		RedactPatterns: []string{
+			"auth", "cookie", "token", "secret", "password", "passwd",
+			"api-key", "apikey", "session", "credential", "signature",
+		},
+		RedactQuery:    accessLog.SensitiveQueryParameters,
+		MaxFieldLength: 256,
+	}
+}
+
+type headerPolicy struct {
+	allow          map[string]bool
+	redact         map[string]bool
+	redactPatterns []string
+	hash           map[string]bool
+	hashKey        []byte
+	redactQuery    accessLog.QueryRedactor
+	maxFieldLength int
+}
+
+func canonicalSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[textproto.CanonicalMIMEHeaderKey(name)] = true
+	}
+	return set
+}
+
+func newHeaderPolicy(p HeaderPolicy) *headerPolicy {
+	hp := &headerPolicy{
+		redact:         canonicalSet(p.Redact),
+		hash:           canonicalSet(p.Hash),
+		hashKey:        p.HashKey,
+		redactQuery:    accessLog.NewQueryRedactor(p.RedactQuery...),
+		maxFieldLength: p.MaxFieldLength,
+	}
+	if len(p.Allow) > 0 {
+		hp.allow = canonicalSet(p.Allow)
+	}
+	for _, pattern := range p.RedactPatterns {
+		hp.redactPatterns = append(hp.redactPatterns, strings.ToLower(pattern))
+	}
+
+	return hp
+}
+
+// Filter returns a function which applies the policy to HTTP headers or
+// gRPC metadata, returning the values to log keyed by canonical name.
+func (p HeaderPolicy) Filter() func(headers map[string][]string) map[string]interface{} {
+	hp := newHeaderPolicy(p)
+	return func(headers map[string][]string) map[string]interface{} {
+		fields := make(map[string]interface{}, len(headers))
+		hp.headers(headers, fields)
+		return fields
+	}
+}
+
+// headers adds the loggable headers to fields, keyed by canonical name.
+// The keys of h needn't be canonical, as gRPC metadata keys are not.
+func (hp *headerPolicy) headers(h http.Header, fields map[string]interface{}) {
+	for key, values := range h {
+		name := textproto.CanonicalMIMEHeaderKey(key)
+		var value string
+		if len(values) > 0 {
+			value = values[0]
+		}
+
+		switch {
+		case hp.redacted(name):
+			fields[name] = Redacted
+		case hp.hash[name]:
+			fields[name] = hp.hashed(value)
+		case hp.allow == nil || hp.allow[name]:
+			fields[name] = hp.truncate(value)
+		}
+	}
+}
+
+// identifier returns value, taken from the named header, as the policy
+// would log the header itself, disregarding the allow-list
+func (hp *headerPolicy) identifier(name, value string) string {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+
+	switch {
+	case hp.redacted(name):
+		return Redacted
+	case hp.hash[name]:
+		return hp.hashed(value)
+	}
+	return hp.truncate(value)
+}
+
+func (hp *headerPolicy) redacted(name string) bool {
+	if hp.redact[name] {
+		return true
+	}
+
+	lower := strings.ToLower(name)
+	for _, pattern := range hp.redactPatterns {
+		if strings.Contains(lower, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func (hp *headerPolicy) hashed(value string) string {
+	if len(hp.hashKey) > 0 {
+		mac := hmac.New(sha256.New, hp.hashKey)
+		mac.Write([]byte(value))
+		return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// query returns the raw query with the sensitive parameter values redacted
+func (hp *headerPolicy) query(rawQuery string) string {
+	return hp.truncate(hp.redactQuery.Redact(rawQuery))
+}
+
+// truncate limits value to maxFieldLength bytes, without splitting a
+// UTF-8 sequence
+func (hp *headerPolicy) truncate(value string) string {
+	if hp.maxFieldLength <= 0 || len(value) <= hp.maxFieldLength {
+		return value
+	}
+
+	n := hp.maxFieldLength
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n] + "..."
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeaderPolicyFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  HeaderPolicy
+		headers map[string][]string
+		want    map[string]interface{}
+	}{
+		{
+			name:   "HTTP credentials",
+			policy: DefaultHeaderPolicy(),
+			headers: map[string][]string{
+				"Authorization": {"Bearer secret"},
+				"Cookie":        {"session=secret"},
+				"X-Api-Key":     {"secret"},
+				"Accept":        {"text/plain"},
+			},
+			want: map[string]interface{}{
+				"Authorization": Redacted,
+				"Cookie":        Redacted,
+				"X-Api-Key":     Redacted,
+				"Accept":        "text/plain",
+			},
+		},
+		{
+			name:   "gRPC metadata",
+			policy: DefaultHeaderPolicy(),
+			headers: map[string][]string{
+				"authorization": {"Bearer secret"},
+				"x-auth-token":  {"secret"},
+				"user-agent":    {"grpc-go/1.0"},
+			},
+			want: map[string]interface{}{
+				"Authorization": Redacted,
+				"X-Auth-Token":  Redacted,
+				"User-Agent":    "grpc-go/1.0",
+			},
+		},
+		{
+			name:   "allow list",
+			policy: HeaderPolicy{Allow: []string{"accept"}, Redact: []string{"Authorization"}},
+			headers: map[string][]string{
+				"Authorization": {"Bearer secret"},
+				"Accept":        {"text/plain"},
+				"User-Agent":    {"curl"},
+			},
+			want: map[string]interface{}{
+				"Authorization": Redacted,
+				"Accept":        "text/plain",
+			},
+		},
+		{
+			name:    "hashed",
+			policy:  HeaderPolicy{Hash: []string{"x-user"}},
+			headers: map[string][]string{"x-user": {"alice"}},
+			want: map[string]interface{}{
+				"X-User": "sha256:2bd806c97f0e00af1a1fc3328fa763a9269723c8db8fac4f93af71db186d6e90",
+			},
+		},
+		{
+			name:    "empty value",
+			policy:  DefaultHeaderPolicy(),
+			headers: map[string][]string{"x-empty": {}},
+			want:    map[string]interface{}{"X-Empty": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.Filter()(tt.headers)
+
+			if len(got) != len(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderPolicyQuery(t *testing.T) {
+	hp := newHeaderPolicy(DefaultHeaderPolicy())
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: ""},
+		{query: "a=1&b=2", want: "a=1&b=2"},
+		{query: "a=1&access_token=secret", want: "a=1&access_token=" + Redacted},
+		{query: "Password=secret&flag", want: "Password=" + Redacted + "&flag"},
+	}
+
+	for _, tt := range tests {
+		if got := hp.query(tt.query); got != tt.want {
+			t.Errorf("query(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderPolicyTruncate(t *testing.T) {
+	tests := []struct {
+		max   int
+		value string
+		want  string
+	}{
+		{max: 0, value: strings.Repeat("a", 300), want: strings.Repeat("a", 300)},
+		{max: 4, value: "abcd", want: "abcd"},
+		{max: 4, value: "abcdef", want: "abcd..."},
+		{max: 4, value: "abcé", want: "abc..."},   // é is 2 bytes
+		{max: 5, value: "abcéf", want: "abcé..."}, // the boundary falls after é
+		{max: 2, value: "日本語", want: "..."},       // 3 byte runes
+		{max: 3, value: "日本語", want: "日..."},
+	}
+
+	for _, tt := range tests {
+		hp := newHeaderPolicy(HeaderPolicy{MaxFieldLength: tt.max})
+		if got := hp.truncate(tt.value); got != tt.want {
+			t.Errorf("truncate(%q) with max %d = %q, want %q", tt.value, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// redMetrics are the request rate, errors & duration metrics, named per
+// the Prometheus conventions
+type redMetrics struct {
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+	inFlight     prometheus.Gauge
+}
+
+var (
+	// DefaultDurationBuckets are the http_request_duration_seconds buckets, in seconds
+	DefaultDurationBuckets = prometheus.DefBuckets
+
+	// DefaultSizeBuckets are the request & response size buckets: 100 bytes to 100MB
+	DefaultSizeBuckets = prometheus.ExponentialBuckets(100, 10, 7)
+)
+
+// Registerer registers the metrics with r rather than the Registerer of
+// the metrics configuration.
+func Registerer(r prometheus.Registerer) MetricsOption {
+	return func(mc *metricsCollector) { mc.registerer = r }
+}
+
+// DurationBuckets sets the http_request_duration_seconds buckets; by
+// default, DefaultDurationBuckets.
+func DurationBuckets(buckets ...float64) MetricsOption {
+	return func(mc *metricsCollector) { mc.durationBuckets = buckets }
+}
+
+// SizeBuckets sets the request & response size buckets, in bytes; by
+// default, DefaultSizeBuckets.
+func SizeBuckets(buckets ...float64) MetricsOption {
+	return func(mc *metricsCollector) { mc.sizeBuckets = buckets }
+}
+
+// StatusClassLabels labels requests with the class of their status,
+// e.g. "4xx", rather than the status itself.
+func StatusClassLabels() MetricsOption {
+	return func(mc *metricsCollector) { mc.statusClass = true }
+}
+
+// LegacyMetrics also records the original metrics (httpRequestsReceived_total,
+// httpRequestsProcessed_total, http_response_duration & http_response_size),
+// so that dashboards & alerts may be migrated.  httpRequestsReceived_total
+// counts requests as they arrive, before the route is recorded, so its
+// url label is the route only when recorded by earlier middleware,
+// otherwise the URLNormalizer's or the fallback.
+func LegacyMetrics(enabled bool) MetricsOption {
+	return func(mc *metricsCollector) { mc.legacy = enabled }
+}
+
+// NewHTTPMetrics returns middleware which records
+//
+//	http_requests_total{method,route,code}
+//	http_request_duration_seconds{method,route,code}
+//	http_request_size_bytes{method,route}
+//	http_response_size_bytes{method,route,code}
+//	http_requests_in_flight
+//
+// The route is labelled as by NewHTTPMetricsCollector.
+func NewHTTPMetrics(opts ...MetricsOption) (func(http.Handler) http.Handler, error) {
+	mc := newMetricsCollector()
+	mc.durationBuckets = DefaultDurationBuckets
+	mc.sizeBuckets = DefaultSizeBuckets
+	for _, opt := range opts {
+		opt(mc)
+	}
+
+	if err := checkBuckets("DurationBuckets", mc.durationBuckets); err != nil {
+		return nil, err
+	}
+	if err := checkBuckets("SizeBuckets", mc.sizeBuckets); err != nil {
+		return nil, err
+	}
+
+	if err := mc.register(); err != nil {
+		return nil, err
+	}
+
+	red, err := newREDMetrics(mc.config(), mc.durationBuckets, mc.sizeBuckets)
+	if err != nil {
+		return nil, err
+	}
+	mc.red = red
+
+	return mc.handler, nil
+}
+
+func checkBuckets(option string, buckets []float64) error {
+	if len(buckets) == 0 {
+		return fmt.Errorf("handlers.%s requires at least one bucket", option)
+	}
+	for i, bucket := range buckets {
+		if math.IsNaN(bucket) || math.IsInf(bucket, 0) {
+			return fmt.Errorf("handlers.%s requires finite buckets", option)
+		}
+		if i > 0 && bucket <= buckets[i-1] {
+			return fmt.Errorf("handlers.%s requires buckets in strictly increasing order", option)
+		}
+	}
+	return nil
+}
+
+func newREDMetrics(cfg *metrics.Config, durationBuckets, sizeBuckets []float64) (*redMetrics, error) {
+	red := &redMetrics{
+		requests: prometheus.NewCounterVec(
+			cfg.CounterOpts("http_requests_total", "Number of HTTP requests completed."),
+			[]string{"method", "route", "code"},
+		),
+		duration: prometheus.NewHistogramVec(
+			cfg.HistogramOpts("http_request_duration_seconds", "Duration of HTTP requests.", durationBuckets),
+			[]string{"method", "route", "code"},
+		),
+		requestSize: prometheus.NewHistogramVec(
+			cfg.HistogramOpts("http_request_size_bytes", "Size of HTTP request bodies.", sizeBuckets),
+			[]string{"method", "route"},
+		),
+		responseSize: prometheus.NewHistogramVec(
+			cfg.HistogramOpts("http_response_size_bytes", "Size of HTTP response bodies.", sizeBuckets),
+			[]string{"method", "route", "code"},
+		),
+		inFlight: prometheus.NewGauge(
+			cfg.GaugeOpts("http_requests_in_flight", "Number of HTTP requests being served."),
+		),
+	}
+
+	// a second middleware shares the metrics already registered
+	c, err := cfg.Register(red.requests)
+	if err != nil {
+		return nil, err
+	}
+	red.requests = c.(*prometheus.CounterVec)
+
+	if c, err = cfg.Register(red.duration); err != nil {
+		return nil, err
+	}
+	red.duration = c.(*prometheus.HistogramVec)
+
+	if c, err = cfg.Register(red.requestSize); err != nil {
+		return nil, err
+	}
+	red.requestSize = c.(*prometheus.HistogramVec)
+
+	if c, err = cfg.Register(red.responseSize); err != nil {
+		return nil, err
+	}
+	red.responseSize = c.(*prometheus.HistogramVec)
+
+	if c, err = cfg.Register(red.inFlight); err != nil {
+		return nil, err
+	}
+	red.inFlight = c.(prometheus.Gauge)
+
+	return red, nil
+}
+
+// methods are labelled as themselves; others as "other", as the method
+// is chosen by the client
+var methods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+func (red *redMetrics) observe(r *http.Request, route, code string, duration time.Duration, size int) {
+	method := r.Method
+	if !methods[method] {
+		method = "other"
+	}
+
+	red.requests.WithLabelValues(method, route, code).Inc()
+	red.duration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+	if r.ContentLength >= 0 {
+		red.requestSize.WithLabelValues(method, route).Observe(float64(r.ContentLength))
+	}
+	red.responseSize.WithLabelValues(method, route, code).Observe(float64(size))
+}
+
+// code returns the status label
+func (mc *metricsCollector) code(status int) string {
+	if status == 0 {
+		// nothing written; net/http responds 200 OK
+		status = http.StatusOK
+	}
+	if mc.statusClass {
+		return strconv.Itoa(status/100) + "xx"
+	}
+	return strconv.Itoa(status)
+}
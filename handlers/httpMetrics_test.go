@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/mchudgins/go-service-helper/route"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHTTPMetricsLabels(t *testing.T) {
+	type request struct {
+		method string
+		route  string // recorded by the handler
+		status int
+	}
+
+	tests := []struct {
+		name     string
+		opts     []MetricsOption
+		requests []request
+		want     []prometheus.Labels // each counted once by http_requests_total
+	}{
+		{
+			name:     "routed",
+			requests: []request{{method: http.MethodGet, route: "/things/{id}", status: http.StatusCreated}},
+			want:     []prometheus.Labels{{"method": "GET", "route": "/things/{id}", "code": "201"}},
+		},
+		{
+			name:     "unrouted, nothing written",
+			requests: []request{{method: http.MethodPost}},
+			want:     []prometheus.Labels{{"method": "POST", "route": UnmatchedURL, "code": "200"}},
+		},
+		{
+			name:     "URLNormalizer",
+			opts:     []MetricsOption{URLNormalizer(func(r *http.Request) string { return "/things/:id" })},
+			requests: []request{{method: http.MethodGet, status: http.StatusNotFound}},
+			want:     []prometheus.Labels{{"method": "GET", "route": "/things/:id", "code": "404"}},
+		},
+		{
+			name:     "FallbackURL",
+			opts:     []MetricsOption{FallbackURL("other")},
+			requests: []request{{method: http.MethodGet}},
+			want:     []prometheus.Labels{{"method": "GET", "route": "other", "code": "200"}},
+		},
+		{
+			name:     "unknown method",
+			requests: []request{{method: "BREW", route: "/pot", status: http.StatusTeapot}},
+			want:     []prometheus.Labels{{"method": "other", "route": "/pot", "code": "418"}},
+		},
+		{
+			name:     "StatusClassLabels",
+			opts:     []MetricsOption{StatusClassLabels()},
+			requests: []request{{method: http.MethodGet, route: "/a", status: http.StatusNotFound}},
+			want:     []prometheus.Labels{{"method": "GET", "route": "/a", "code": "4xx"}},
+		},
+		{
+			name: "MaxURLs",
+			opts: []MetricsOption{MaxURLs(1)},
+			requests: []request{
+				{method: http.MethodGet, route: "/a"},
+				{method: http.MethodGet, route: "/b"},
+			},
+			want: []prometheus.Labels{
+				{"method": "GET", "route": "/a", "code": "200"},
+				{"method": "GET", "route": UnmatchedURL, "code": "200"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			cfg, err := metrics.New(metrics.Registry(registry))
+			if err != nil {
+				t.Fatal(err)
+			}
+			collector, err := NewHTTPMetrics(append([]MetricsOption{WithMetrics(cfg)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, req := range tt.requests {
+				req := req
+				h := collector(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if len(req.route) > 0 {
+						route.Set(r.Context(), req.route)
+					}
+					if req.status != 0 {
+						w.WriteHeader(req.status)
+					}
+				}))
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, "/things/1", nil))
+			}
+
+			for _, labels := range tt.want {
+				if n := counterValue(t, registry, "http_requests_total", labels); n != 1 {
+					t.Errorf("http_requests_total%v = %v, want 1", labels, n)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHTTPMetricsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  MetricsOption
+	}{
+		{name: "no duration buckets", opt: DurationBuckets()},
+		{name: "unsorted duration buckets", opt: DurationBuckets(1, 0.5)},
+		{name: "duplicate duration buckets", opt: DurationBuckets(0.1, 0.1, 1)},
+		{name: "NaN duration bucket", opt: DurationBuckets(0.1, math.NaN())},
+		{name: "infinite duration bucket", opt: DurationBuckets(0.1, math.Inf(1))},
+		{name: "no size buckets", opt: SizeBuckets()},
+		{name: "unsorted size buckets", opt: SizeBuckets(1000, 100)},
+		{name: "duplicate size buckets", opt: SizeBuckets(100, 1000, 1000)},
+		{name: "negative infinite size bucket", opt: SizeBuckets(math.Inf(-1), 100)},
+	}
+
+	for _, tt := range tests {
+		cfg, err := metrics.New(metrics.Registry(prometheus.NewRegistry()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewHTTPMetrics(WithMetrics(cfg), tt.opt); err == nil {
+			t.Errorf("%s: NewHTTPMetrics succeeded, want an error", tt.name)
+		}
+	}
+}
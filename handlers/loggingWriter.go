@@ -2,51 +2,50 @@ package handlers
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"net/textproto"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/mchudgins/go-service-helper/accessLog"
 	"github.com/mchudgins/go-service-helper/correlationID"
 	"github.com/mchudgins/go-service-helper/httpWriter"
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/route"
 	"github.com/mchudgins/go-service-helper/user"
 )
 
-type key int
-
-var loggerKey key = 0
+// FromContext returns the request scoped logger; the bool is always true.
+//
+// Deprecated: use logger.FromContext, which HTTP & gRPC handlers share.
+func FromContext(ctx context.Context) (logger.Logger, bool) {
+	return logger.FromContext(ctx), true
+}
 
-func FromContext(ctx context.Context) (*logrus.Entry, bool) {
-	logger, ok := ctx.Value(loggerKey).(*logrus.Entry)
-	return logger, ok
+// NewHTTPApacheLogger returns middleware which writes an Apache Combined
+// Log Format line for each request to os.Stdout.  Use the accessLog
+// package for other formats & outputs.
+func NewHTTPApacheLogger() (func(http.Handler) http.Handler, error) {
+	al, err := accessLog.New(accessLog.WithFormat(accessLog.Combined))
+	if err != nil {
+		return nil, err
+	}
+	return al.Handler, nil
 }
 
-// httpLogger provides per request log statements (ala Apache httpd)
+// HttpApacheLogger writes an Apache Combined Log Format line for each
+// request to os.Stdout.  Should the access log not be created, the error
+// is logged & requests are not logged.
+//
+// Deprecated: use NewHTTPApacheLogger, which returns the error.
 func HttpApacheLogger(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		lw := httpWriter.NewHTTPWriter(w)
-		defer func() {
-			end := time.Now()
-			duration := end.Sub(start)
-			log.Printf("host: %s; uri: %s; CorrelationID: %s; remoteAddress: %s; method:  %s; proto: %s; status: %d, contentLength: %d, duration: %.3f; ua: %s",
-				r.Host,
-				r.RequestURI,
-				lw.Header().Get(correlationID.CORRID),
-				r.RemoteAddr,
-				r.Method,
-				r.Proto,
-				lw.StatusCode(),
-				lw.Length(),
-				duration.Seconds()*1000,
-				r.UserAgent())
-		}()
-
-		h.ServeHTTP(lw, r)
-
-	})
+	apacheLogger, err := NewHTTPApacheLogger()
+	if err != nil {
+		logger.Default().Error("unable to create the Apache access log", logger.Err(err))
+		return h
+	}
+	return apacheLogger(h)
 }
 
 func getRequestURIFromRaw(rawURI string) string {
@@ -59,14 +58,80 @@ func getRequestURIFromRaw(rawURI string) string {
 	return rawURI[:i]
 }
 
+type httpLogger struct {
+	logger     logger.Logger
+	policy     *headerPolicy
+	sampler    *accessLog.Sampler
+	corrHeader string
+}
+
+// HTTPLoggerOption configures the middleware returned by NewHTTPLogger.
+type HTTPLoggerOption func(*httpLogger)
+
+// Logger sets the logger requests are logged to; by default, logger.Default().
+func Logger(l logger.Logger) HTTPLoggerOption {
+	return func(hl *httpLogger) { hl.logger = l }
+}
+
+// WithHeaderPolicy sets which request headers & query parameters are
+// logged; by default, DefaultHeaderPolicy().
+func WithHeaderPolicy(p HeaderPolicy) HTTPLoggerOption {
+	return func(hl *httpLogger) { hl.policy = newHeaderPolicy(p) }
+}
+
+// WithSampler logs only the requests chosen by the Sampler, e.g. to log
+// a fraction of a high volume route's successful requests.
+func WithSampler(s *accessLog.Sampler) HTTPLoggerOption {
+	return func(hl *httpLogger) { hl.sampler = s }
+}
+
+// CorrelationID logs the correlation ID, should the caller not have sent
+// one, from the Extractor's response header; by default, that of
+// correlationID.Default().
+func CorrelationID(e *correlationID.Extractor) HTTPLoggerOption {
+	return func(hl *httpLogger) {
+		if e != nil {
+			hl.corrHeader = e.Header()
+		}
+	}
+}
+
+// HTTPLogrusLogger logs each request to the default logger.
+//
+// Deprecated: use NewHTTPLogger, which accepts any logger.Logger.
 func HTTPLogrusLogger(h http.Handler) http.Handler {
+	return NewHTTPLogger()(h)
+}
+
+// NewHTTPLogger returns middleware which logs a structured entry for
+// each request, and makes the logger available to handlers via
+// logger.FromContext.
+func NewHTTPLogger(opts ...HTTPLoggerOption) func(http.Handler) http.Handler {
+	hl := &httpLogger{}
+	for _, opt := range opts {
+		opt(hl)
+	}
+	if hl.policy == nil {
+		hl.policy = newHeaderPolicy(DefaultHeaderPolicy())
+	}
+	if len(hl.corrHeader) == 0 {
+		hl.corrHeader = correlationID.Default().Header()
+	}
+	hl.corrHeader = textproto.CanonicalMIMEHeaderKey(hl.corrHeader)
+
+	return hl.handler
+}
+
+func (hl *httpLogger) handler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		start := time.Now()
 
-		ctx := r.Context()
-		l := logrus.New().WithField(correlationID.CORRID, correlationID.FromContext(ctx))
-		r = r.WithContext(context.WithValue(ctx, loggerKey, l))
+		base := hl.logger
+		if base == nil {
+			base = logger.Default()
+		}
+		r = r.WithContext(logger.NewContext(r.Context(), base))
 
 		lw := httpWriter.NewHTTPWriter(w)
 
@@ -77,24 +142,37 @@ func HTTPLogrusLogger(h http.Handler) http.Handler {
 		method := r.Method
 		proto := r.Proto
 
-		fields := logrus.Fields{}
+		fields := make(map[string]interface{})
 		fields["Host"] = host
-		for key := range r.Header {
-			fields[textproto.CanonicalMIMEHeaderKey(key)] = r.Header.Get(key)
+		hl.policy.headers(r.Header, fields)
+		fields["URL"] = hl.policy.truncate(url)
+		if query := hl.policy.query(r.URL.RawQuery); len(query) > 0 {
+			fields["query"] = query
 		}
-		fields["URL"] = url
 		fields["remoteIP"] = remoteAddr
 		fields["method"] = method
 		fields["proto"] = proto
 
 		defer func() {
-			fields["status"] = lw.StatusCode()
+			end := time.Now()
+			duration := end.Sub(start)
+
+			status := lw.StatusCode()
+			if status == 0 {
+				// nothing written; net/http responds 200 OK
+				status = http.StatusOK
+			}
+			if hl.sampler != nil && !hl.sampler.Sampled(route.FromContext(r.Context()), status, duration) {
+				return
+			}
+
+			fields["status"] = status
 			fields["length"] = lw.Length()
 
-			// maybe the X-Request-ID was set on the way back?
-			id, ok := fields[correlationID.CORRID].(string)
+			// maybe the correlation ID was set on the way back?
+			id, ok := fields[hl.corrHeader].(string)
 			if !ok || len(id) == 0 {
-				fields[correlationID.CORRID] = lw.Header().Get(correlationID.CORRID)
+				fields[hl.corrHeader] = lw.Header().Get(hl.corrHeader)
 			}
 
 			// get some info about the response
@@ -107,25 +185,35 @@ func HTTPLogrusLogger(h http.Handler) http.Handler {
 				fields["response-Cache-Control"] = cc
 			}
 
-			end := time.Now()
-			duration := end.Sub(start)
-
 			fields["duration"] = duration.Seconds() * 1000
 			fields["time"] = start.Format("20060102030405.000000")
 
-			// who dat?
-			_, uid := user.FromRequest(r)
-			if len(uid) == 0 {
-				uid = user.FromContext(r.Context())
-				if len(uid) > 0 {
-					fields["userID"] = uid
+			// who dat? (a user ID in the context is added by the request logger)
+			if len(user.FromContext(r.Context())) == 0 {
+				if _, uid := user.FromRequest(r); len(uid) > 0 {
+					fields["userID"] = hl.policy.identifier(user.USERID, uid)
 				}
 			}
 
-			logrus.WithFields(fields).Info("")
+			logger.FromContext(r.Context()).Info("", logFields(fields)...)
 		}()
 
 		h.ServeHTTP(lw, r)
 
 	})
 }
+
+// logFields converts the map, sorted by key so entries are consistent
+func logFields(fields map[string]interface{}) []logger.Field {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lf := make([]logger.Field, len(keys))
+	for i, key := range keys {
+		lf[i] = logger.Any(key, fields[key])
+	}
+	return lf
+}
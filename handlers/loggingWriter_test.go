@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mchudgins/go-service-helper/correlationID"
+	"github.com/mchudgins/go-service-helper/logger"
+)
+
+// lineLogger remembers the fields of the last line logged at Info, by
+// it or the loggers derived from it by With
+type lineLogger struct {
+	with []logger.Field
+	last *map[string]interface{}
+}
+
+func newLineLogger() *lineLogger {
+	return &lineLogger{last: new(map[string]interface{})}
+}
+
+func (l *lineLogger) fields() map[string]interface{} { return *l.last }
+
+func (l *lineLogger) Debug(string, ...logger.Field) {}
+func (l *lineLogger) Warn(string, ...logger.Field)  {}
+func (l *lineLogger) Error(string, ...logger.Field) {}
+func (l *lineLogger) Sync() error                   { return nil }
+func (l *lineLogger) With(fields ...logger.Field) logger.Logger {
+	return &lineLogger{with: append(append([]logger.Field{}, l.with...), fields...), last: l.last}
+}
+func (l *lineLogger) Info(msg string, fields ...logger.Field) {
+	m := make(map[string]interface{})
+	for _, f := range append(append([]logger.Field{}, l.with...), fields...) {
+		m[f.Key] = f.Value
+	}
+	*l.last = m
+}
+
+func TestHTTPLogger(t *testing.T) {
+	xcorrid, err := correlationID.NewExtractor(correlationID.Headers(correlationID.XCORRID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []HTTPLoggerOption
+		handler http.HandlerFunc
+		want    map[string]interface{}
+	}{
+		{
+			name:    "writes nothing",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			want:    map[string]interface{}{"status": http.StatusOK, "length": 0},
+		},
+		{
+			name:    "not found",
+			handler: http.NotFound,
+			want:    map[string]interface{}{"status": http.StatusNotFound},
+		},
+		{
+			name: "correlation ID set on the way back",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(correlationID.CORRID, "abc")
+			},
+			want: map[string]interface{}{correlationID.CORRID: "abc"},
+		},
+		{
+			name: "configured correlation ID header",
+			opts: []HTTPLoggerOption{CorrelationID(xcorrid)},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(correlationID.XCORRID, "abc")
+			},
+			want: map[string]interface{}{correlationID.XCORRID: "abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newLineLogger()
+			h := NewHTTPLogger(append([]HTTPLoggerOption{Logger(log)}, tt.opts...)...)(tt.handler)
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			fields := log.fields()
+			for k, v := range tt.want {
+				if fields[k] != v {
+					t.Errorf("%s = %v, want %v", k, fields[k], v)
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,13 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/mchudgins/go-service-helper/correlationID"
 	"github.com/mchudgins/go-service-helper/httpWriter"
 	"github.com/mchudgins/go-service-helper/hystrix"
+	"github.com/mchudgins/go-service-helper/logger"
 	"github.com/mchudgins/go-service-helper/zipkin"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
@@ -22,31 +23,50 @@ var (
 
 type traceLogger struct{}
 
-func (logger traceLogger) Log(keyval ...interface{}) error {
-	fields := make(log.Fields)
+func (traceLogger) Log(keyval ...interface{}) error {
+	fields := make([]logger.Field, 0, len(keyval)/2)
 	len := len(keyval)
 
-	for i := 0; i < len; i = +2 {
+	for i := 0; i+1 < len; i += 2 {
 		if key, ok := keyval[i].(string); ok {
-			fields[key] = keyval[i+1]
+			fields = append(fields, logger.Any(key, keyval[i+1]))
 		} else {
-			log.WithField("field", keyval[i]).
-				Error("key name is not of type 'string'")
+			logger.Default().Error("key name is not of type 'string'",
+				logger.Any("field", keyval[i]))
 		}
 	}
 
-	log.WithFields(fields).Info("opentracer.go")
+	logger.Default().Info("opentracer.go", fields...)
 
 	return nil
 }
 
+// NewTracer returns a zipkin tracer, which it also makes opentracing's
+// global tracer, or, should that fail, logs the error & returns a tracer
+// which records nothing.
 func NewTracer(serviceName string) opentracing.Tracer {
+	tracer, _, err := NewTracerAndCollector(serviceName)
+	if err != nil {
+		logger.Default().Error("unable to construct the zipkin tracer; tracing is disabled", logger.Err(err))
+		return opentracing.NoopTracer{}
+	}
+
+	opentracing.SetGlobalTracer(tracer)
+
+	return tracer
+}
+
+// NewTracerAndCollector is NewTracer, but also returns the span collector
+// so that it may be closed (flushing any buffered spans) on shutdown,
+// and returns, rather than logs, any error.  The global tracer is left
+// unchanged.
+func NewTracerAndCollector(serviceName string) (opentracing.Tracer, openzipkin.Collector, error) {
 	collector, err := zipkin.NewHTTPCollector(zipkinHTTPEndpoint,
 		zipkin.HTTPLogger(traceLogger{}),
 		zipkin.HTTPClient(hystrix.NewClient("zipkin")),
 		zipkin.HTTPBatchSize(100))
 	if err != nil {
-		log.WithError(err).Fatal("zipkin.NewHTTPCollector failed")
+		return nil, nil, fmt.Errorf("unable to construct the zipkin collector: %s", err)
 	}
 
 	tracer, err := openzipkin.NewTracer(
@@ -55,80 +75,59 @@ func NewTracer(serviceName string) opentracing.Tracer {
 		//		zipkin.DebugMode(true),
 		//		zipkin.ClientServerSameSpan(true),
 	)
-
 	if err != nil {
-		log.WithError(err).Warn("unable to construct zipkin.Tracer")
+		collector.Close()
+		return nil, nil, fmt.Errorf("unable to construct the zipkin tracer: %s", err)
 	}
 
-	opentracing.SetGlobalTracer(tracer)
-
-	return tracer
+	return tracer, collector, nil
 }
 
 // HandlerFunc is a middleware function for incoming HTTP requests.
 type HandlerFunc func(next http.Handler) http.Handler
 
-// FromHTTPRequest returns a Middleware HandlerFunc that tries to join with an
+// TracerOption configures the middleware returned by TracerFromHTTPRequest.
+type TracerOption func(*tracerConfig)
+
+type tracerConfig struct {
+	correlationID *correlationID.Extractor
+}
+
+// TracerCorrelationID tags requests, which earlier middleware has not,
+// with a correlation ID using the Extractor; by default,
+// correlationID.Default().
+func TracerCorrelationID(e *correlationID.Extractor) TracerOption {
+	return func(tc *tracerConfig) { tc.correlationID = e }
+}
+
+// TracerFromHTTPRequest returns a Middleware HandlerFunc that tries to join with an
 // OpenTracing trace found in the HTTP request headers and starts a new Span
 // called `operationName`. If no trace could be found in the HTTP request
 // headers, the Span will be a trace root. The Span is incorporated in the
 // HTTP Context object and can be retrieved with
-// opentracing.SpanFromContext(ctx).
-/*
-func TracerFromHTTPRequest(tracer opentracing.Tracer, operationName string,
-) HandlerFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			span, ctx := opentracing.StartSpanFromContext(req.Context(), operationName)
-			defer span.Finish()
-
-			// tag this request with a correlation ID, so we can troubleshoot it later, if necessary
-			req, corrID := correlationID.FromRequest(req)
-			w.Header().Set(correlationID.CORRID, corrID)
-			span.SetTag(correlationID.CORRID, corrID)
-			ext.HTTPUrl.Set(span, req.URL.Path)
-
-			// store span in context
-			ctx = opentracing.ContextWithSpan(req.Context(), span)
-
-			// update request context to include our new span
-			req = req.WithContext(ctx)
-
-			// we want the status code from the handler chain,
-			// so inject an HTTPWriter, if one doesn't exist
-
-			if _, ok := w.(*httpWriter.HTTPWriter); !ok {
-				w = httpWriter.NewHTTPWriter(w)
-			}
-
-			// next middleware or actual request handler
-			next.ServeHTTP(w, req)
-
-			if hw, ok := w.(*httpWriter.HTTPWriter); ok {
-				span.SetTag(string(ext.HTTPStatusCode), hw.StatusCode())
-			}
-		})
+// opentracing.SpanFromContext(ctx).  A nil tracer is opentracing's
+// global tracer, as it is when each request arrives.
+func TracerFromHTTPRequest(tracer opentracing.Tracer, operationName string, opts ...TracerOption) HandlerFunc {
+	tc := &tracerConfig{}
+	for _, opt := range opts {
+		opt(tc)
 	}
-}
-*/
+	if tc.correlationID == nil {
+		tc.correlationID = correlationID.Default()
+	}
+	extractor := tc.correlationID
 
-func TracerFromHTTPRequest(tracer opentracing.Tracer, operationName string,
-) HandlerFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 
-			// tag this request with a correlation ID, so we can troubleshoot it later, if necessary
-			req, corrID, fExisted := correlationID.FromRequest(req)
-
-			// if we're at the edge of the system, send the correlation ID back in the response
-			if !fExisted {
-				w.Header().Set(correlationID.CORRID, corrID)
-			}
-
 			var serverSpan opentracing.Span
 			//			appSpecificOperationName := operationName
 			appSpecificOperationName := req.Method + ":" + req.URL.Path
-			wireContext, err := opentracing.GlobalTracer().Extract(
+			tracer := tracer
+			if tracer == nil {
+				tracer = opentracing.GlobalTracer()
+			}
+			wireContext, err := tracer.Extract(
 				opentracing.HTTPHeaders,
 				opentracing.HTTPHeadersCarrier(req.Header))
 			if err != nil {
@@ -138,14 +137,28 @@ func TracerFromHTTPRequest(tracer opentracing.Tracer, operationName string,
 
 			// Create the span referring to the RPC client if available.
 			// If wireContext == nil, a root span will be created.
-			serverSpan = opentracing.StartSpan(
+			serverSpan = tracer.StartSpan(
 				appSpecificOperationName,
 				ext.RPCServerOption(wireContext))
 
 			defer serverSpan.Finish()
 
+			ctx := opentracing.ContextWithSpan(req.Context(), serverSpan)
+
+			// update request context to include our new span
+			req = req.WithContext(ctx)
+
+			// tag this request with a correlation ID, so we can troubleshoot it later, if necessary
+			// (once the span is in the context, so an ID may be derived from the trace)
+			req, corrID, fExisted := extractor.FromRequest(req)
+
+			// if we're at the edge of the system, send the correlation ID back in the response
+			if !fExisted {
+				w.Header().Set(extractor.Header(), corrID)
+			}
+
 			ext.HTTPUrl.Set(serverSpan, req.URL.Path)
-			serverSpan.SetTag(correlationID.CORRID, corrID)
+			serverSpan.SetTag(extractor.Header(), corrID)
 
 			/*
 				serverSpan.LogFields(
@@ -153,11 +166,6 @@ func TracerFromHTTPRequest(tracer opentracing.Tracer, operationName string,
 				)
 			*/
 
-			ctx := opentracing.ContextWithSpan(req.Context(), serverSpan)
-
-			// update request context to include our new span
-			req = req.WithContext(ctx)
-
 			// we want the status code from the handler chain,
 			// so inject an HTTPWriter, if one doesn't exist
 
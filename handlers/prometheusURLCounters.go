@@ -3,56 +3,222 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/mchudgins/go-service-helper/httpWriter"
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/mchudgins/go-service-helper/route"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// legacyMetrics are the original request metrics
+type legacyMetrics struct {
+	requestsReceived  *prometheus.CounterVec
+	requestsProcessed *prometheus.CounterVec
+	requestDuration   *prometheus.SummaryVec
+	responseSize      *prometheus.SummaryVec
+}
+
+func newLegacyMetrics(cfg *metrics.Config) (*legacyMetrics, error) {
+	m := &legacyMetrics{
+		requestsReceived: prometheus.NewCounterVec(
+			cfg.CounterOpts("httpRequestsReceived_total", "Number of HTTP requests received."),
+			[]string{"url"},
+		),
+		requestsProcessed: prometheus.NewCounterVec(
+			cfg.CounterOpts("httpRequestsProcessed_total", "Number of HTTP requests processed."),
+			[]string{"url", "status"},
+		),
+		requestDuration: prometheus.NewSummaryVec(
+			cfg.SummaryOpts("http_response_duration", "Duration of HTTP responses."),
+			[]string{"url", "status"},
+		),
+		responseSize: prometheus.NewSummaryVec(
+			cfg.SummaryOpts("http_response_size", "Size of http responses"),
+			[]string{"url"},
+		),
+	}
+
+	// a second middleware shares the metrics already registered
+	c, err := cfg.Register(m.requestsReceived)
+	if err != nil {
+		return nil, err
+	}
+	m.requestsReceived = c.(*prometheus.CounterVec)
+
+	if c, err = cfg.Register(m.requestsProcessed); err != nil {
+		return nil, err
+	}
+	m.requestsProcessed = c.(*prometheus.CounterVec)
+
+	if c, err = cfg.Register(m.requestDuration); err != nil {
+		return nil, err
+	}
+	m.requestDuration = c.(*prometheus.SummaryVec)
+
+	if c, err = cfg.Register(m.responseSize); err != nil {
+		return nil, err
+	}
+	m.responseSize = c.(*prometheus.SummaryVec)
+
+	return m, nil
+}
+
+func (m *legacyMetrics) received(url string) {
+	m.requestsReceived.With(prometheus.Labels{"url": url}).Inc()
+}
+
+func (m *legacyMetrics) observe(url string, status int, duration time.Duration, size int) {
+	if status == 0 {
+		// nothing written; net/http responds 200 OK
+		status = http.StatusOK
+	}
+	code := strconv.Itoa(status)
+
+	m.requestsProcessed.With(prometheus.Labels{"url": url, "status": code}).Inc()
+	m.requestDuration.With(prometheus.Labels{"url": url, "status": code}).Observe(float64(duration.Nanoseconds()))
+	m.responseSize.With(prometheus.Labels{"url": url}).Observe(float64(size))
+}
+
+// HTTPMetricsCollector records request metrics, labelled by route, with
+// the default options.  The metrics are registered with
+// prometheus.DefaultRegisterer on first use.
+func HTTPMetricsCollector(fn http.Handler) http.Handler {
+	defaultMetricsOnce.Do(func() {
+		defaultMetricsCollector = NewHTTPMetricsCollector()
+	})
+	return defaultMetricsCollector(fn)
+}
+
 var (
-	httpRequestsReceived = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "httpRequestsReceived_total",
-			Help: "Number of HTTP requests received.",
-		},
-		[]string{"url"},
-	)
-	httpRequestsProcessed = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "httpRequestsProcessed_total",
-			Help: "Number of HTTP requests processed.",
-		},
-		[]string{"url", "status"},
-	)
-	httpRequestDuration = prometheus.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Name: "http_response_duration",
-			Help: "Duration of HTTP responses.",
-		},
-		[]string{"url", "status"},
-	)
-	httpResponseSize = prometheus.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Name: "http_response_size",
-			Help: "Size of http responses",
-		},
-		[]string{"url"},
-	)
+	defaultMetricsOnce      sync.Once
+	defaultMetricsCollector func(http.Handler) http.Handler
+)
+
+const (
+	// UnmatchedURL labels the metrics of requests with no known route
+	UnmatchedURL = "unmatched"
+
+	defaultMaxURLs = 500
 )
 
-func init() {
-	prometheus.MustRegister(httpRequestsReceived)
-	prometheus.MustRegister(httpRequestsProcessed)
-	prometheus.MustRegister(httpRequestDuration)
-	prometheus.MustRegister(httpResponseSize)
+type metricsCollector struct {
+	normalizer func(r *http.Request) string
+	fallback   string
+	maxURLs    int
+	mutex      sync.RWMutex
+	urls       map[string]bool
+
+	metrics         *metrics.Config
+	registerer      prometheus.Registerer // if non-nil, overrides metrics.Registerer
+	legacy          bool                  // record the original metrics
+	old             *legacyMetrics
+	red             *redMetrics // if non-nil, record the RED metrics
+	durationBuckets []float64
+	sizeBuckets     []float64
+	statusClass     bool
 }
 
-func HTTPMetricsCollector(fn http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// MetricsOption configures the middleware returned by NewHTTPMetrics or
+// NewHTTPMetricsCollector.
+type MetricsOption func(*metricsCollector)
+
+// URLNormalizer labels requests with no recorded route; e.g. replacing
+// the IDs in the path with a placeholder.  An empty result is labelled
+// with the fallback.
+func URLNormalizer(fn func(r *http.Request) string) MetricsOption {
+	return func(mc *metricsCollector) { mc.normalizer = fn }
+}
+
+// FallbackURL sets the label of requests with no route; by default, UnmatchedURL.
+func FallbackURL(label string) MetricsOption {
+	return func(mc *metricsCollector) { mc.fallback = label }
+}
+
+// WithMetrics registers the metrics per cfg; by default, metrics.Default().
+func WithMetrics(cfg *metrics.Config) MetricsOption {
+	return func(mc *metricsCollector) {
+		if cfg != nil {
+			mc.metrics = cfg
+		}
+	}
+}
+
+// MaxURLs limits the number of distinct url labels (default 500); once
+// reached, requests for other routes are labelled with the fallback.
+func MaxURLs(n int) MetricsOption {
+	return func(mc *metricsCollector) { mc.maxURLs = n }
+}
+
+// NewHTTPMetricsCollector returns middleware which records the original
+// request metrics, labelled with the route which served the request, as
+// recorded by the route package (gorilla mux's path template or the
+// ActuatorMux pattern), rather than the path, so that IDs in paths do
+// not create unbounded series.  Should the metrics not register, the
+// error is logged & the requests are not measured.
+func NewHTTPMetricsCollector(opts ...MetricsOption) func(http.Handler) http.Handler {
+	mc := newMetricsCollector()
+	mc.legacy = true
+	for _, opt := range opts {
+		opt(mc)
+	}
+
+	if err := mc.register(); err != nil {
+		logger.Default().Error("unable to register the HTTP metrics", logger.Err(err))
+		return func(h http.Handler) http.Handler { return h }
+	}
+
+	return mc.handler
+}
+
+func newMetricsCollector() *metricsCollector {
+	return &metricsCollector{
+		fallback: UnmatchedURL,
+		maxURLs:  defaultMaxURLs,
+		urls:     make(map[string]bool),
+		metrics:  metrics.Default(),
+	}
+}
+
+// register creates the legacy metrics, if required
+func (mc *metricsCollector) register() error {
+	if !mc.legacy {
+		return nil
+	}
+
+	old, err := newLegacyMetrics(mc.config())
+	if err != nil {
+		return err
+	}
+	mc.old = old
+
+	return nil
+}
+
+// config returns the metrics configuration, with the Registerer option applied
+func (mc *metricsCollector) config() *metrics.Config {
+	if mc.registerer == nil {
+		return mc.metrics
+	}
+
+	cfg := *mc.metrics
+	cfg.Registerer = mc.registerer
+	return &cfg
+}
+
+func (mc *metricsCollector) handler(fn http.Handler) http.Handler {
+	return route.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		u := r.URL.Path
-		httpRequestsReceived.With(prometheus.Labels{"url": u}).Inc()
+		if mc.red != nil {
+			mc.red.inFlight.Inc()
+			defer mc.red.inFlight.Dec()
+		}
+		if mc.old != nil {
+			mc.old.received(mc.label(r))
+		}
 
 		// we want the status code from the handler chain,
 		// so inject an HTTPWriter, if one doesn't exist
@@ -61,19 +227,55 @@ func HTTPMetricsCollector(fn http.Handler) http.Handler {
 			w = httpWriter.NewHTTPWriter(w)
 		}
 
-		// after ServeHTTP runs, collect metrics!
+		// after ServeHTTP runs, the route is known, so collect metrics!
 
 		defer func() {
-			if hw, ok := w.(*httpWriter.HTTPWriter); ok {
-				status := strconv.Itoa(hw.StatusCode())
-				httpRequestsProcessed.With(prometheus.Labels{"url": u, "status": status}).Inc()
-				end := time.Now()
-				duration := end.Sub(start)
-				httpRequestDuration.With(prometheus.Labels{"url": u, "status": status}).Observe(float64(duration.Nanoseconds()))
-				httpResponseSize.With(prometheus.Labels{"url": u}).Observe(float64(hw.Length()))
+			u := mc.label(r)
+			hw, ok := w.(*httpWriter.HTTPWriter)
+			if !ok {
+				return
+			}
+			end := time.Now()
+			duration := end.Sub(start)
+
+			if mc.old != nil {
+				mc.old.observe(u, hw.StatusCode(), duration, hw.Length())
+			}
+
+			if mc.red != nil {
+				mc.red.observe(r, u, mc.code(hw.StatusCode()), duration, hw.Length())
 			}
 		}()
 
 		fn.ServeHTTP(w, r)
-	})
+	}))
+}
+
+// label returns the request's url label, limiting the distinct labels to maxURLs
+func (mc *metricsCollector) label(r *http.Request) string {
+	u := route.FromContext(r.Context())
+	if len(u) == 0 && mc.normalizer != nil {
+		u = mc.normalizer(r)
+	}
+	if len(u) == 0 {
+		return mc.fallback
+	}
+
+	mc.mutex.RLock()
+	known := mc.urls[u]
+	mc.mutex.RUnlock()
+	if known {
+		return u
+	}
+
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	if !mc.urls[u] {
+		if mc.maxURLs > 0 && len(mc.urls) >= mc.maxURLs {
+			return mc.fallback
+		}
+		mc.urls[u] = true
+	}
+	return u
 }
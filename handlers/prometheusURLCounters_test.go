@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/mchudgins/go-service-helper/route"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counterValue returns the value of the named counter with the labels
+func counterValue(t *testing.T, g prometheus.Gatherer, name string, labels prometheus.Labels) float64 {
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if labels[pair.GetName()] != pair.GetValue() {
+					continue metrics
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestLegacyMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   string // recorded before the metrics middleware
+		handler http.HandlerFunc
+		url     string
+		status  string
+	}{
+		{
+			name:    "writes nothing",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			url:     UnmatchedURL,
+			status:  "200",
+		},
+		{
+			name:    "not found",
+			handler: http.NotFound,
+			url:     UnmatchedURL,
+			status:  "404",
+		},
+		{
+			name:    "routed",
+			route:   "/things/{id}",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) },
+			url:     "/things/{id}",
+			status:  "201",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			cfg, err := metrics.New(metrics.Registry(registry))
+			if err != nil {
+				t.Fatal(err)
+			}
+			collector, err := NewHTTPMetrics(WithMetrics(cfg), LegacyMetrics(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			received := prometheus.Labels{"url": tt.url}
+			h := collector(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the request is counted as it arrives
+				if n := counterValue(t, registry, "httpRequestsReceived_total", received); n != 1 {
+					t.Errorf("httpRequestsReceived_total while serving = %v, want 1", n)
+				}
+				tt.handler(w, r)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/things/1", nil)
+			if len(tt.route) > 0 {
+				r = r.WithContext(route.NewContext(r.Context(), tt.route))
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			processed := prometheus.Labels{"url": tt.url, "status": tt.status}
+			if n := counterValue(t, registry, "httpRequestsProcessed_total", processed); n != 1 {
+				t.Errorf("httpRequestsProcessed_total%v = %v, want 1", processed, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// the gRPC services published by the registry; the overall ("")
+// status tracks readiness, as that's what load balancers care about
+const (
+	overallService   = ""
+	livenessService  = "liveness"
+	readinessService = "readiness"
+)
+
+// GRPCServer returns the grpc.health.v1 service backed by this registry.
+// Register it with grpc_health_v1.RegisterHealthServer; its status is
+// updated every time the checks are evaluated (see Monitor).
+func (r *Registry) GRPCServer() *health.Server {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.grpcHealth == nil {
+		r.grpcHealth = health.NewServer()
+	}
+
+	return r.grpcHealth
+}
+
+// Monitor evaluates the checks every interval until ctx is done, so gRPC
+// health clients see changes even when nobody polls the HTTP probes.
+func (r *Registry) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.Liveness(ctx)
+		r.Readiness(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown reports every gRPC health service as NOT_SERVING and ignores
+// any further updates; call it once the process begins to shut down.
+func (r *Registry) Shutdown() {
+	r.mutex.RLock()
+	srv := r.grpcHealth
+	r.mutex.RUnlock()
+
+	if srv != nil {
+		srv.Shutdown()
+	}
+}
+
+// publish pushes a report to the gRPC health service, if there is one
+func (r *Registry) publish(service string, report Report) {
+	r.mutex.RLock()
+	srv := r.grpcHealth
+	r.mutex.RUnlock()
+
+	if srv == nil {
+		return
+	}
+
+	srv.SetServingStatus(service, servingStatus(report.Healthy()))
+	if service == readinessService {
+		srv.SetServingStatus(overallService, servingStatus(report.Healthy()))
+	}
+	for name, result := range report.Checks {
+		srv.SetServingStatus(service+"/"+name, servingStatus(result.Status != StatusDown))
+	}
+}
+
+func servingStatus(healthy bool) healthpb.HealthCheckResponse_ServingStatus {
+	if healthy {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
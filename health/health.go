@@ -0,0 +1,255 @@
+// Package health provides a registry of named liveness & readiness checks which
+// is published both as HTTP probes (/healthz, /readyz) and through the
+// gRPC grpc.health.v1 service, so every client sees the same state.
+//
+// example:
+//
+//	registry := health.NewRegistry()
+//	registry.RegisterReadiness("database", health.CheckerFunc(db.PingContext),
+//		health.WithTimeout(time.Second), health.WithCacheTTL(5*time.Second))
+//	http.Handle("/readyz", registry.ReadinessHandler())
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+)
+
+// Checker reports the health of a single component; a nil error is healthy.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts an ordinary function to the Checker interface.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Status summarizes the result of one or more checks.
+type Status string
+
+const (
+	StatusUp       Status = "UP"
+	StatusDegraded Status = "DEGRADED" // only non-critical checks are failing
+	StatusDown     Status = "DOWN"
+)
+
+const (
+	defaultTimeout = time.Duration(2) * time.Second
+)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status    Status    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report aggregates the results of a set of checks.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Healthy is true unless a critical check has failed.
+func (r Report) Healthy() bool {
+	return r.Status != StatusDown
+}
+
+// Option configures an individual check.
+type Option func(*check)
+
+// WithTimeout limits how long the check may run before it is
+// considered to have failed (default: 2 seconds).
+func WithTimeout(d time.Duration) Option {
+	return func(c *check) { c.timeout = d }
+}
+
+// WithCacheTTL reuses the last result of the check for the given
+// duration, protecting expensive checks from aggressive probes.
+func WithCacheTTL(d time.Duration) Option {
+	return func(c *check) { c.cacheTTL = d }
+}
+
+// NonCritical marks the check as informational: its failure degrades
+// the report but does not make the service unhealthy.
+func NonCritical() Option {
+	return func(c *check) { c.critical = false }
+}
+
+type check struct {
+	checker  Checker
+	timeout  time.Duration
+	cacheTTL time.Duration
+	critical bool
+	mutex    sync.Mutex
+	last     Result
+}
+
+// run executes the check, or returns its cached result. A failure
+// caused by the caller's context ending is not cached, so one
+// impatient probe cannot mark the check down for everyone else.
+func (c *check) run(parent context.Context) Result {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.cacheTTL > 0 && !c.last.CheckedAt.IsZero() && time.Since(c.last.CheckedAt) < c.cacheTTL {
+		return c.last
+	}
+
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = fmt.Errorf("check did not complete: %s", ctx.Err())
+	}
+
+	result := Result{
+		Status:    StatusUp,
+		Critical:  c.critical,
+		Duration:  time.Since(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	if err == nil || parent.Err() == nil {
+		c.last = result
+	}
+
+	return result
+}
+
+// Registry holds the liveness & readiness checks for a service.
+type Registry struct {
+	mutex      sync.RWMutex
+	liveness   map[string]*check
+	readiness  map[string]*check
+	grpcHealth *health.Server
+}
+
+// NewRegistry returns an empty Registry; with no checks registered
+// the service is reported as healthy & ready.
+func NewRegistry() *Registry {
+	return &Registry{
+		liveness:  make(map[string]*check),
+		readiness: make(map[string]*check),
+	}
+}
+
+// RegisterLiveness adds a check which, if failing, indicates the
+// process should be restarted.
+func (r *Registry) RegisterLiveness(name string, c Checker, opts ...Option) error {
+	return r.register(r.liveness, name, c, opts)
+}
+
+// RegisterReadiness adds a check which, if failing, indicates the
+// process should not receive traffic.
+func (r *Registry) RegisterReadiness(name string, c Checker, opts ...Option) error {
+	return r.register(r.readiness, name, c, opts)
+}
+
+func (r *Registry) register(checks map[string]*check, name string, c Checker, opts []Option) error {
+	if len(name) == 0 {
+		return fmt.Errorf("health checks must be named")
+	}
+	if c == nil {
+		return fmt.Errorf("health check %s has no Checker", name)
+	}
+
+	chk := &check{
+		checker:  c,
+		timeout:  defaultTimeout,
+		critical: true,
+	}
+	for _, opt := range opts {
+		opt(chk)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := checks[name]; ok {
+		return fmt.Errorf("health check %s is already registered", name)
+	}
+	checks[name] = chk
+
+	return nil
+}
+
+// Liveness runs the liveness checks (concurrently) and reports the results.
+func (r *Registry) Liveness(ctx context.Context) Report {
+	report := r.evaluate(ctx, r.liveness)
+	r.publish(livenessService, report)
+
+	return report
+}
+
+// Readiness runs the readiness checks (concurrently) and reports the results.
+func (r *Registry) Readiness(ctx context.Context) Report {
+	report := r.evaluate(ctx, r.readiness)
+	r.publish(readinessService, report)
+
+	return report
+}
+
+func (r *Registry) evaluate(ctx context.Context, checks map[string]*check) Report {
+	r.mutex.RLock()
+	pending := make(map[string]*check, len(checks))
+	for name, c := range checks {
+		pending[name] = c
+	}
+	r.mutex.RUnlock()
+
+	report := Report{
+		Status: StatusUp,
+		Checks: make(map[string]Result, len(pending)),
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, c := range pending {
+		wg.Add(1)
+		go func(name string, c *check) {
+			defer wg.Done()
+
+			result := c.run(ctx)
+
+			mutex.Lock()
+			report.Checks[name] = result
+			mutex.Unlock()
+		}(name, c)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusDown {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
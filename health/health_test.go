@@ -0,0 +1,217 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	up   = CheckerFunc(func(ctx context.Context) error { return nil })
+	down = CheckerFunc(func(ctx context.Context) error { return errors.New("down") })
+	hung = CheckerFunc(func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() })
+)
+
+func TestReadiness(t *testing.T) {
+	type registration struct {
+		name    string
+		checker Checker
+		opts    []Option
+	}
+
+	tests := []struct {
+		name   string
+		checks []registration
+		status Status
+		code   int
+		grpc   map[string]healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{
+			name:   "no checks",
+			status: StatusUp,
+			code:   http.StatusOK,
+			grpc: map[string]healthpb.HealthCheckResponse_ServingStatus{
+				"":          healthpb.HealthCheckResponse_SERVING,
+				"readiness": healthpb.HealthCheckResponse_SERVING,
+			},
+		},
+		{
+			name:   "all up",
+			checks: []registration{{"a", up, nil}, {"b", up, nil}},
+			status: StatusUp,
+			code:   http.StatusOK,
+			grpc: map[string]healthpb.HealthCheckResponse_ServingStatus{
+				"":            healthpb.HealthCheckResponse_SERVING,
+				"readiness/a": healthpb.HealthCheckResponse_SERVING,
+			},
+		},
+		{
+			name:   "non-critical down",
+			checks: []registration{{"a", up, nil}, {"b", down, []Option{NonCritical()}}},
+			status: StatusDegraded,
+			code:   http.StatusOK,
+			grpc: map[string]healthpb.HealthCheckResponse_ServingStatus{
+				"":            healthpb.HealthCheckResponse_SERVING,
+				"readiness/b": healthpb.HealthCheckResponse_NOT_SERVING,
+			},
+		},
+		{
+			name:   "critical down",
+			checks: []registration{{"a", down, nil}, {"b", down, []Option{NonCritical()}}},
+			status: StatusDown,
+			code:   http.StatusServiceUnavailable,
+			grpc: map[string]healthpb.HealthCheckResponse_ServingStatus{
+				"":            healthpb.HealthCheckResponse_NOT_SERVING,
+				"readiness":   healthpb.HealthCheckResponse_NOT_SERVING,
+				"readiness/a": healthpb.HealthCheckResponse_NOT_SERVING,
+			},
+		},
+		{
+			name:   "timed out",
+			checks: []registration{{"a", hung, []Option{WithTimeout(10 * time.Millisecond)}}},
+			status: StatusDown,
+			code:   http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			srv := r.GRPCServer()
+			for _, c := range tt.checks {
+				if err := r.RegisterReadiness(c.name, c.checker, c.opts...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			r.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.code {
+				t.Errorf("status code = %d, want %d", w.Code, tt.code)
+			}
+
+			if report := r.Readiness(context.Background()); report.Status != tt.status {
+				t.Errorf("status = %s, want %s", report.Status, tt.status)
+			}
+
+			for service, want := range tt.grpc {
+				resp, err := srv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+				if err != nil {
+					t.Errorf("gRPC %q: %v", service, err)
+					continue
+				}
+				if resp.Status != want {
+					t.Errorf("gRPC %q = %s, want %s", service, resp.Status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		calls int
+	}{
+		{name: "uncached", calls: 3},
+		{name: "cached", ttl: time.Minute, calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			r := NewRegistry()
+			err := r.RegisterLiveness("counted", CheckerFunc(func(ctx context.Context) error {
+				calls++
+				return nil
+			}), WithCacheTTL(tt.ttl))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 3; i++ {
+				r.Liveness(context.Background())
+			}
+			if calls != tt.calls {
+				t.Errorf("checked %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+type hangKey struct{}
+
+func TestCacheAbandonedCheck(t *testing.T) {
+	// the check hangs only when called with the first context
+	hang := context.WithValue(context.Background(), hangKey{}, true)
+	cancelled, cancel := context.WithCancel(hang)
+	cancel()
+	expired, cancel := context.WithTimeout(hang, time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		timeout time.Duration
+		cached  bool
+	}{
+		{name: "caller cancelled", ctx: cancelled, timeout: time.Minute},
+		{name: "caller timed out", ctx: expired, timeout: time.Minute},
+		{name: "check timed out", ctx: hang, timeout: time.Millisecond, cached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			err := r.RegisterLiveness("hung", CheckerFunc(func(ctx context.Context) error {
+				if ctx.Value(hangKey{}) != nil {
+					return hung(ctx)
+				}
+				return nil
+			}), WithTimeout(tt.timeout), WithCacheTTL(time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Liveness(tt.ctx).Healthy() {
+				t.Fatal("first check is healthy, want it to fail")
+			}
+			if cached := !r.Liveness(context.Background()).Healthy(); cached != tt.cached {
+				t.Errorf("failure cached = %v, want %v", cached, tt.cached)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry()
+	if err := r.RegisterLiveness("a", up); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		checker Checker
+	}{
+		{name: "", checker: up},
+		{name: "no checker"},
+		{name: "a", checker: up}, // already registered
+	}
+
+	for _, tt := range tests {
+		if err := r.RegisterLiveness(tt.name, tt.checker); err == nil {
+			t.Errorf("RegisterLiveness(%q) succeeded, want an error", tt.name)
+		}
+	}
+
+	// the liveness & readiness checks are distinct
+	if err := r.RegisterReadiness("a", up); err != nil {
+		t.Errorf("RegisterReadiness(%q) = %v", "a", err)
+	}
+}
@@ -0,0 +1,39 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// LivenessHandler serves the liveness report as JSON, with a
+// 503 status if the service is unhealthy.
+func (r *Registry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Liveness(req.Context()))
+	})
+}
+
+// ReadinessHandler serves the readiness report as JSON, with a
+// 503 status if the service should not receive traffic.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Readiness(req.Context()))
+	})
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	out, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if report.Healthy() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(out)
+}
@@ -3,20 +3,20 @@ package httpWriter
 import (
 	"net/http"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/mchudgins/go-service-helper/logger"
 )
 
 type HTTPWriter struct {
 	w             http.ResponseWriter
 	statusCode    int
 	contentLength int
-	logger        *log.Entry
+	logger        logger.Logger
 }
 
 type Option func(w *HTTPWriter)
 
-func Logger(logger *log.Entry) Option {
-	return func(w *HTTPWriter) { w.logger = logger }
+func Logger(l logger.Logger) Option {
+	return func(w *HTTPWriter) { w.logger = l }
 }
 
 func NewHTTPWriter(w http.ResponseWriter, options ...Option) *HTTPWriter {
@@ -36,10 +36,9 @@ func (l *HTTPWriter) Header() http.Header {
 func (l *HTTPWriter) Write(data []byte) (int, error) {
 
 	if l.logger != nil {
-		l.logger.
-			WithField("data", string(data)).
-			WithField("len", len(data)).
-			Info("HTTPWriter.Write")
+		l.logger.Info("HTTPWriter.Write",
+			logger.String("data", string(data)),
+			logger.Int("len", len(data)))
 	}
 
 	l.contentLength += len(data)
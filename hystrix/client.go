@@ -1,88 +1,185 @@
 package hystrix
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync/atomic"
 
-	"fmt"
-
-	log "github.com/sirupsen/logrus"
 	"github.com/afex/hystrix-go/hystrix"
+	"github.com/mchudgins/go-service-helper/logger"
+)
+
+// The errors returned when the circuit breaker, rather than the server,
+// fails a request.
+var (
+	ErrTimeout        = hystrix.ErrTimeout
+	ErrCircuitOpen    = hystrix.ErrCircuitOpen
+	ErrMaxConcurrency = hystrix.ErrMaxConcurrency
 )
 
+// HTTPClient is an http.Client whose requests pass through the named
+// hystrix circuit breaker.  Requests honor the deadline & cancellation
+// of their context.
 type HTTPClient struct {
 	http.Client
 	HystrixCommandName string
+	Retry              *RetryPolicy // if nil, each request is attempted once
 }
 
-func NewClient(commandName string) *HTTPClient {
+// NewClient returns a client whose requests pass through the named
+// circuit breaker, configuring it with the options, if any.  Invalid
+// options are logged & ignored; use Configure to check them.
+func NewClient(commandName string, opts ...CommandOption) *HTTPClient {
+	if len(opts) > 0 {
+		if err := Configure(commandName, opts...); err != nil {
+			logger.Default().Error("unable to configure the circuit breaker",
+				logger.Err(err),
+				logger.String("commandName", commandName))
+		}
+	}
+
 	return &HTTPClient{
 		HystrixCommandName: commandName,
 	}
 }
 
-func circuitBreaker(u, commandName string, fn func() (*http.Response, error)) (*http.Response, error) {
+// the states of a call made by the circuit breaker
+const (
+	callPending int32 = iota
+	callStarted
+	callAbandoned
+)
 
-	output := make(chan *http.Response, 1)
-	defer close(output)
-	errors := make(chan error, 1)
-	defer close(errors)
+type result struct {
+	response *http.Response
+	err      error
+}
 
-	hystrix.Go(commandName, func() error {
-		response, err := fn()
-		if err != nil {
-			errors <- err
-		} else {
-			output <- response
-			if response.StatusCode == http.StatusInternalServerError {
-				return fmt.Errorf("error %d", response.StatusCode)
-			}
+// cancelBody releases the call's context once the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Do sends the request via the circuit breaker, which the command's
+// FailurePolicy informs of the result; as with http.Client, responses
+// are returned whatever their status.  If the breaker times
+// out, is open or has too many requests in flight, ErrTimeout,
+// ErrCircuitOpen or ErrMaxConcurrency is returned; if the request's
+// context is done, its error is returned.  An abandoned request is
+// cancelled & its response body, should one arrive, closed.  Failed
+// requests are retried per the client's RetryPolicy, if any.
+func (c *HTTPClient) Do(r *http.Request) (*http.Response, error) {
+	if c.Retry != nil {
+		return c.Retry.do(c, r)
+	}
+	return c.attempt(r)
+}
+
+// attempt sends the request, once, via the circuit breaker
+func (c *HTTPClient) attempt(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	callCtx, cancel := context.WithCancel(ctx)
+
+	// buffered, so the call never blocks once abandoned
+	results := make(chan result, 1)
+	var state int32
+
+	errc := hystrix.GoC(ctx, c.HystrixCommandName, func(ctx context.Context) error {
+		if !atomic.CompareAndSwapInt32(&state, callPending, callStarted) {
+			return ctx.Err()
 		}
 
-		return err
-	}, func(err error) error {
-		log.WithError(err).WithFields(log.Fields{"commandName": commandName, "URL": u}).
-			Info("breaker closed")
-		return err
-	})
+		response, err := c.Client.Do(r.WithContext(callCtx))
+		results <- result{response: response, err: err}
+		if err != nil {
+			return classify(r.Context(), c.HystrixCommandName, 0, err)
+		}
+		return classify(r.Context(), c.HystrixCommandName, response.StatusCode, nil)
+	}, nil)
 
 	select {
-	case r := <-output:
-		return r, nil
+	case res := <-results:
+		return c.finish(res, cancel)
+
+	case err := <-errc:
+		// the call may have completed, yet been classified as a failure
+		// (e.g. a 503) or ignored
+		select {
+		case res := <-results:
+			return c.finish(res, cancel)
+		default:
+		}
+
+		c.abandon(&state, results, cancel)
+
+		logger.FromContext(ctx).Warn("circuit breaker failed the request",
+			logger.Err(err),
+			logger.String("commandName", c.HystrixCommandName),
+			logger.String("URL", r.URL.Path))
 
-	case err := <-errors:
 		return nil, err
 	}
 }
 
-func (c *HTTPClient) Do(r *http.Request) (*http.Response, error) {
-	return circuitBreaker(r.URL.Path, c.HystrixCommandName, func() (*http.Response, error) {
-		return c.Client.Do(r)
-	})
+func (c *HTTPClient) finish(res result, cancel context.CancelFunc) (*http.Response, error) {
+	if res.err != nil {
+		cancel()
+		return nil, res.err
+	}
+
+	res.response.Body = &cancelBody{ReadCloser: res.response.Body, cancel: cancel}
+	return res.response, nil
+}
+
+// abandon cancels a call which has started & closes the body of any
+// response it receives; a call which has not started never will
+func (c *HTTPClient) abandon(state *int32, results chan result, cancel context.CancelFunc) {
+	cancel()
+
+	if !atomic.CompareAndSwapInt32(state, callPending, callAbandoned) {
+		go func() {
+			if res := <-results; res.response != nil {
+				res.response.Body.Close()
+			}
+		}()
+	}
 }
 
 func (c *HTTPClient) Get(url string) (*http.Response, error) {
-	return circuitBreaker(url, c.HystrixCommandName, func() (*http.Response, error) {
-		return c.Client.Get(url)
-	})
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
 }
 
 func (c *HTTPClient) Head(url string) (*http.Response, error) {
-	return circuitBreaker(url, c.HystrixCommandName, func() (*http.Response, error) {
-		return c.Client.Head(url)
-	})
-
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
 }
 
 func (c *HTTPClient) Post(url string, contentType string, body io.Reader) (*http.Response, error) {
-	return circuitBreaker(url, c.HystrixCommandName, func() (*http.Response, error) {
-		return c.Client.Post(url, contentType, body)
-	})
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
 }
 
 func (c *HTTPClient) PostForm(url string, data url.Values) (*http.Response, error) {
-	return circuitBreaker(url, c.HystrixCommandName, func() (*http.Response, error) {
-		return c.Client.PostForm(url, data)
-	})
+	return c.Post(url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
 }
@@ -0,0 +1,102 @@
+package hystrix
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientDo(t *testing.T) {
+	const slow = 200 * time.Millisecond
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		opts    []CommandOption
+		handler http.HandlerFunc
+		ctx     func() (context.Context, context.CancelFunc)
+		status  int
+		body    string
+		err     error
+	}{
+		{
+			name:    "OK",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) },
+			status:  http.StatusOK,
+			body:    "ok",
+		},
+		{
+			name:    "failure status returned",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			status:  http.StatusServiceUnavailable,
+		},
+		{
+			name:    "cancelled",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			ctx:     func() (context.Context, context.CancelFunc) { return cancelled, func() {} },
+			err:     context.Canceled,
+		},
+		{
+			name:    "deadline",
+			handler: func(w http.ResponseWriter, r *http.Request) { time.Sleep(slow) },
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), slow/4)
+			},
+			err: context.DeadlineExceeded,
+		},
+		{
+			name:    "breaker timeout",
+			opts:    []CommandOption{Timeout(slow / 4)},
+			handler: func(w http.ResponseWriter, r *http.Request) { time.Sleep(slow) },
+			err:     ErrTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			c := NewClient("TestHTTPClientDo "+tt.name, tt.opts...)
+
+			ctx, cancel := context.Background(), func() {}
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+
+			r, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := c.Do(r.WithContext(ctx))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Do() = %v, want %v", err, tt.err)
+				}
+				if response != nil {
+					t.Errorf("a response was returned with the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+
+			body, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tt.status || string(body) != tt.body {
+				t.Errorf("response = %d %q, want %d %q", response.StatusCode, body, tt.status, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package hystrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	"github.com/mchudgins/go-service-helper/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+// CommandConfig configures a command's circuit breaker.  Zero values
+// select the hystrix defaults.
+type CommandConfig struct {
+	Timeout                time.Duration   // time allowed for the command to complete
+	MaxConcurrentRequests  int             // requests allowed in flight at once
+	RequestVolumeThreshold int             // requests, in the rolling window, before the circuit may open
+	SleepWindow            time.Duration   // time the circuit stays open before a trial request
+	ErrorPercentThreshold  int             // percentage of failures which opens the circuit
+	FailurePolicy          FailurePolicy   // classifies results; nil selects DefaultFailurePolicy
+	Fallback               Fallback        // serves failed requests; nil selects UnavailableFallback(SleepWindow)
+	Metrics                *metrics.Config // registers the Handler's fallback counter; nil selects metrics.Default()
+}
+
+type CommandOption func(*CommandConfig) error
+
+func Timeout(d time.Duration) CommandOption {
+	return func(c *CommandConfig) error {
+		if d < 0 {
+			return fmt.Errorf("hystrix.Timeout requires a non-negative duration, not %s", d)
+		}
+		c.Timeout = d
+		return nil
+	}
+}
+
+func MaxConcurrentRequests(n int) CommandOption {
+	return func(c *CommandConfig) error {
+		if n < 0 {
+			return fmt.Errorf("hystrix.MaxConcurrentRequests requires a non-negative number, not %d", n)
+		}
+		c.MaxConcurrentRequests = n
+		return nil
+	}
+}
+
+func RequestVolumeThreshold(n int) CommandOption {
+	return func(c *CommandConfig) error {
+		if n < 0 {
+			return fmt.Errorf("hystrix.RequestVolumeThreshold requires a non-negative number, not %d", n)
+		}
+		c.RequestVolumeThreshold = n
+		return nil
+	}
+}
+
+func SleepWindow(d time.Duration) CommandOption {
+	return func(c *CommandConfig) error {
+		if d < 0 {
+			return fmt.Errorf("hystrix.SleepWindow requires a non-negative duration, not %s", d)
+		}
+		c.SleepWindow = d
+		return nil
+	}
+}
+
+func ErrorPercentThreshold(percent int) CommandOption {
+	return func(c *CommandConfig) error {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("hystrix.ErrorPercentThreshold requires a percentage, not %d", percent)
+		}
+		c.ErrorPercentThreshold = percent
+		return nil
+	}
+}
+
+// WithFailurePolicy classifies the command's results with p, rather
+// than DefaultFailurePolicy.
+func WithFailurePolicy(p FailurePolicy) CommandOption {
+	return func(c *CommandConfig) error {
+		c.FailurePolicy = p
+		return nil
+	}
+}
+
+// WithFallback serves the requests which the command's circuit breaker
+// fails with f, rather than a 503 (Service Unavailable) response.
+func WithFallback(f Fallback) CommandOption {
+	return func(c *CommandConfig) error {
+		c.Fallback = f
+		return nil
+	}
+}
+
+// CommandMetrics registers the metrics of the command's
+// NewHystrixHelper per cfg; by default, metrics.Default().
+func CommandMetrics(cfg *metrics.Config) CommandOption {
+	return func(c *CommandConfig) error {
+		if cfg == nil {
+			return fmt.Errorf("hystrix.CommandMetrics requires a non-nil metrics.Config")
+		}
+		c.Metrics = cfg
+		return nil
+	}
+}
+
+// WithCommandConfig replaces every setting with those of cfg.
+func WithCommandConfig(cfg CommandConfig) CommandOption {
+	return func(c *CommandConfig) error {
+		for _, opt := range []CommandOption{
+			Timeout(cfg.Timeout),
+			MaxConcurrentRequests(cfg.MaxConcurrentRequests),
+			RequestVolumeThreshold(cfg.RequestVolumeThreshold),
+			SleepWindow(cfg.SleepWindow),
+			ErrorPercentThreshold(cfg.ErrorPercentThreshold),
+			WithFailurePolicy(cfg.FailurePolicy),
+			WithFallback(cfg.Fallback),
+		} {
+			if err := opt(c); err != nil {
+				return err
+			}
+		}
+		c.Metrics = cfg.Metrics
+		return nil
+	}
+}
+
+var (
+	commandsMutex sync.Mutex
+	commands      = make(map[string]CommandConfig)
+)
+
+// Configure changes the named command's settings, leaving those not
+// given as they were.  It may be called at any time; however, hystrix
+// only sizes a circuit's pool of concurrent requests when the circuit
+// is first used.
+func Configure(commandName string, opts ...CommandOption) error {
+	commandsMutex.Lock()
+	defer commandsMutex.Unlock()
+
+	cfg, ok := commands[commandName]
+	if !ok {
+		cfg = current(commandName)
+	}
+
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return err
+		}
+	}
+
+	commands[commandName] = cfg
+	hystrix.ConfigureCommand(commandName, hystrix.CommandConfig{
+		Timeout:                milliseconds(cfg.Timeout),
+		MaxConcurrentRequests:  cfg.MaxConcurrentRequests,
+		RequestVolumeThreshold: cfg.RequestVolumeThreshold,
+		SleepWindow:            milliseconds(cfg.SleepWindow),
+		ErrorPercentThreshold:  cfg.ErrorPercentThreshold,
+	})
+
+	return nil
+}
+
+// configured is true if the command has settings, from Configure or
+// from hystrix.ConfigureCommand
+func configured(commandName string) bool {
+	commandsMutex.Lock()
+	_, ok := commands[commandName]
+	commandsMutex.Unlock()
+	if ok {
+		return true
+	}
+
+	_, ok = hystrix.GetCircuitSettings()[commandName]
+	return ok
+}
+
+// current returns the settings of a command configured directly with
+// hystrix.ConfigureCommand, if any
+func current(commandName string) CommandConfig {
+	s, ok := hystrix.GetCircuitSettings()[commandName]
+	if !ok || s == nil {
+		return CommandConfig{}
+	}
+
+	return CommandConfig{
+		Timeout:                s.Timeout,
+		MaxConcurrentRequests:  s.MaxConcurrentRequests,
+		RequestVolumeThreshold: int(s.RequestVolumeThreshold),
+		SleepWindow:            s.SleepWindow,
+		ErrorPercentThreshold:  s.ErrorPercentThreshold,
+	}
+}
+
+func milliseconds(d time.Duration) int {
+	return int(d / time.Millisecond)
+}
+
+// duration is read from configuration files as a Go duration, e.g.
+// "1.5s", or as a number of milliseconds, as hystrix does
+type duration time.Duration
+
+func (d *duration) set(s string) error {
+	if ms, err := strconv.Atoi(s); err == nil {
+		*d = duration(time.Duration(ms) * time.Millisecond)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		s = string(b)
+	}
+	return d.set(s)
+}
+
+func (d *duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.set(s)
+}
+
+// commandFile is a command's entry in a configuration file
+type commandFile struct {
+	Timeout                duration `json:"timeout" yaml:"timeout"`
+	MaxConcurrentRequests  int      `json:"maxConcurrentRequests" yaml:"maxConcurrentRequests"`
+	RequestVolumeThreshold int      `json:"requestVolumeThreshold" yaml:"requestVolumeThreshold"`
+	SleepWindow            duration `json:"sleepWindow" yaml:"sleepWindow"`
+	ErrorPercentThreshold  int      `json:"errorPercentThreshold" yaml:"errorPercentThreshold"`
+}
+
+// LoadFile configures the commands described by a JSON (*.json) or YAML
+// file, keyed by command name, e.g.
+//
+//	users:
+//	  timeout: 250ms
+//	  maxConcurrentRequests: 50
+//	  requestVolumeThreshold: 20
+//	  sleepWindow: 5s
+//	  errorPercentThreshold: 25
+//
+// Each command's settings are replaced, so settings removed from the
+// file revert to the defaults when the file is reloaded.  A command's
+// FailurePolicy & Fallback, which a file cannot express, are kept.
+// Should any entry be invalid, no command is changed.
+func LoadFile(filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return load(b, json.Unmarshal)
+	}
+	return load(b, yaml.Unmarshal)
+}
+
+// LoadEnv configures the commands described by the environment
+// variable, which holds a JSON or YAML document, as LoadFile reads.  An
+// unset variable configures nothing.
+func LoadEnv(key string) error {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+
+	// YAML is a superset of JSON
+	return load([]byte(value), yaml.Unmarshal)
+}
+
+// load configures the commands described by the document.  Every entry
+// is checked before any is applied, so that an invalid file changes
+// nothing.
+func load(b []byte, unmarshal func([]byte, interface{}) error) error {
+	var file map[string]commandFile
+	if err := unmarshal(b, &file); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(file))
+	for name := range file {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		var scratch CommandConfig
+		for _, opt := range file[name].options() {
+			if err := opt(&scratch); err != nil {
+				problems = append(problems, fmt.Sprintf("command %s: %s", name, err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	for _, name := range names {
+		if err := Configure(name, file[name].options()...); err != nil {
+			return fmt.Errorf("command %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// options are the settings of the entry
+func (c commandFile) options() []CommandOption {
+	return []CommandOption{
+		Timeout(time.Duration(c.Timeout)),
+		MaxConcurrentRequests(c.MaxConcurrentRequests),
+		RequestVolumeThreshold(c.RequestVolumeThreshold),
+		SleepWindow(time.Duration(c.SleepWindow)),
+		ErrorPercentThreshold(c.ErrorPercentThreshold),
+	}
+}
+
+// effectiveSettings are the settings hystrix uses, defaults included
+type effectiveSettings struct {
+	Timeout                string `json:"timeout"`
+	MaxConcurrentRequests  int    `json:"maxConcurrentRequests"`
+	RequestVolumeThreshold uint64 `json:"requestVolumeThreshold"`
+	SleepWindow            string `json:"sleepWindow"`
+	ErrorPercentThreshold  int    `json:"errorPercentThreshold"`
+}
+
+// ConfigHandler serves the settings in effect for each command, as JSON.
+func ConfigHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := make(map[string]effectiveSettings)
+		for name, s := range hystrix.GetCircuitSettings() {
+			if s == nil {
+				continue
+			}
+			settings[name] = effectiveSettings{
+				Timeout:                s.Timeout.String(),
+				MaxConcurrentRequests:  s.MaxConcurrentRequests,
+				RequestVolumeThreshold: s.RequestVolumeThreshold,
+				SleepWindow:            s.SleepWindow.String(),
+				ErrorPercentThreshold:  s.ErrorPercentThreshold,
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(settings)
+	})
+}
@@ -0,0 +1,148 @@
+package hystrix
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// settings returns the command's settings, if it has been configured
+func settings(commandName string) (CommandConfig, bool) {
+	commandsMutex.Lock()
+	defer commandsMutex.Unlock()
+
+	cfg, ok := commands[commandName]
+	return cfg, ok
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		json      bool
+		document  string
+		err       string
+		configure map[string]CommandConfig // nil values: the command is left unconfigured
+	}{
+		{
+			name: "YAML",
+			document: `
+yaml-users:
+  timeout: 250ms
+  maxConcurrentRequests: 50
+  requestVolumeThreshold: 20
+  sleepWindow: 5000
+  errorPercentThreshold: 25
+`,
+			configure: map[string]CommandConfig{
+				"yaml-users": {
+					Timeout:                250 * time.Millisecond,
+					MaxConcurrentRequests:  50,
+					RequestVolumeThreshold: 20,
+					SleepWindow:            5 * time.Second,
+					ErrorPercentThreshold:  25,
+				},
+			},
+		},
+		{
+			name:     "JSON",
+			json:     true,
+			document: `{"json-users": {"timeout": 100, "sleepWindow": "1.5s"}}`,
+			configure: map[string]CommandConfig{
+				"json-users": {Timeout: 100 * time.Millisecond, SleepWindow: 1500 * time.Millisecond},
+			},
+		},
+		{
+			name: "an invalid entry changes nothing",
+			document: `
+invalid-a:
+  timeout: 1s
+invalid-b:
+  errorPercentThreshold: 101
+invalid-c:
+  maxConcurrentRequests: -1
+`,
+			err:       "command invalid-b: hystrix.ErrorPercentThreshold requires a percentage, not 101; command invalid-c:",
+			configure: map[string]CommandConfig{"invalid-a": {}, "invalid-b": {}, "invalid-c": {}},
+		},
+		{
+			name:      "malformed duration",
+			document:  "malformed:\n  timeout: soon\n",
+			err:       "soon",
+			configure: map[string]CommandConfig{"malformed": {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unmarshal := yaml.Unmarshal
+			if tt.json {
+				unmarshal = json.Unmarshal
+			}
+
+			err := load([]byte(tt.document), unmarshal)
+			if len(tt.err) == 0 && err != nil || len(tt.err) > 0 && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("load() = %v, want %q", err, tt.err)
+			}
+
+			for name, want := range tt.configure {
+				got, ok := settings(name)
+				if len(tt.err) > 0 {
+					if ok {
+						t.Errorf("%s was configured: %+v", name, got)
+					}
+					continue
+				}
+				if !ok || got.Timeout != want.Timeout ||
+					got.MaxConcurrentRequests != want.MaxConcurrentRequests ||
+					got.RequestVolumeThreshold != want.RequestVolumeThreshold ||
+					got.SleepWindow != want.SleepWindow ||
+					got.ErrorPercentThreshold != want.ErrorPercentThreshold {
+					t.Errorf("%s = %+v, want %+v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hystrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		filename string
+		content  string
+		command  string
+		timeout  time.Duration
+	}{
+		{filename: "commands.json", content: `{"file-json": {"timeout": "2s"}}`, command: "file-json", timeout: 2 * time.Second},
+		{filename: "commands.YAML", content: "file-yaml:\n  timeout: 3s\n", command: "file-yaml", timeout: 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		filename := filepath.Join(dir, tt.filename)
+		if err := ioutil.WriteFile(filename, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := LoadFile(filename); err != nil {
+			t.Errorf("LoadFile(%s) = %v", tt.filename, err)
+			continue
+		}
+		if cfg, _ := settings(tt.command); cfg.Timeout != tt.timeout {
+			t.Errorf("%s timeout = %s, want %s", tt.command, cfg.Timeout, tt.timeout)
+		}
+	}
+
+	if err := LoadFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("LoadFile of a missing file succeeded")
+	}
+}
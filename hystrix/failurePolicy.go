@@ -0,0 +1,113 @@
+package hystrix
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Outcome is the effect of a request upon its circuit breaker.
+type Outcome int
+
+const (
+	Success Outcome = iota // the dependency is healthy
+	Failure                // the dependency is unhealthy; failures open the circuit
+	Ignore                 // the result says nothing about the dependency's health; see FailurePolicy
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Success:
+		return "success"
+	case Failure:
+		return "failure"
+	case Ignore:
+		return "ignore"
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// FailurePolicy classifies the result of a request: either the status
+// of its response or, if there is no response, the error.
+//
+// hystrix has no notion of an ignored result, so they are reported as
+// cancelled: they are not errors, so never open the circuit, but are
+// still counted as requests, i.e. toward the RequestVolumeThreshold &
+// in the ErrorPercentThreshold's denominator.  Requests the caller
+// abandoned, by cancelling its context or letting its deadline pass,
+// are ignored without consulting the policy.
+type FailurePolicy func(status int, err error) Outcome
+
+// DefaultFailurePolicy counts errors, including timeouts, & 5xx
+// responses, including the gateway errors 502, 503 & 504, as failures.
+// Cancelled requests, and 429 (Too Many Requests) responses, which
+// throttle the caller rather than reflect the dependency's health, are
+// ignored.
+func DefaultFailurePolicy(status int, err error) Outcome {
+	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		if err == context.Canceled {
+			return Ignore
+		}
+		return Failure
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		return Ignore
+	case status >= 500 && status < 600:
+		return Failure
+	}
+	return Success
+}
+
+// StatusPolicy classifies the responses whose status is in outcomes as
+// given, & every other result with the fallback policy, e.g.
+//
+//	StatusPolicy(map[int]Outcome{http.StatusConflict: Failure}, DefaultFailurePolicy)
+func StatusPolicy(outcomes map[int]Outcome, fallback FailurePolicy) FailurePolicy {
+	return func(status int, err error) Outcome {
+		if err == nil {
+			if o, ok := outcomes[status]; ok {
+				return o
+			}
+		}
+		return fallback(status, err)
+	}
+}
+
+// failurePolicy returns the command's policy
+func failurePolicy(commandName string) FailurePolicy {
+	commandsMutex.Lock()
+	defer commandsMutex.Unlock()
+
+	if p := commands[commandName].FailurePolicy; p != nil {
+		return p
+	}
+	return DefaultFailurePolicy
+}
+
+// classify returns the error, if any, which reports the result to the
+// circuit breaker: context.Canceled, which hystrix counts as neither a
+// success nor an error, for ignored results.  ctx is the caller's.
+func classify(ctx context.Context, commandName string, status int, err error) error {
+	// the caller gave up, so its deadline says nothing about the dependency
+	if ctx.Err() != nil {
+		return context.Canceled
+	}
+
+	switch failurePolicy(commandName)(status, err) {
+	case Failure:
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%s responded %d", commandName, status)
+
+	case Ignore:
+		return context.Canceled
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package hystrix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// clientTimeout is the error net/http returns when Client.Timeout elapses
+type clientTimeout struct{}
+
+func (clientTimeout) Error() string     { return "Client.Timeout exceeded while awaiting headers" }
+func (clientTimeout) Timeout() bool     { return true }
+func (clientTimeout) Is(err error) bool { return err == context.DeadlineExceeded }
+
+func TestDefaultFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   Outcome
+	}{
+		{name: "200", status: http.StatusOK, want: Success},
+		{name: "404", status: http.StatusNotFound, want: Success},
+		{name: "429", status: http.StatusTooManyRequests, want: Ignore},
+		{name: "500", status: http.StatusInternalServerError, want: Failure},
+		{name: "503", status: http.StatusServiceUnavailable, want: Failure},
+		{name: "connection refused", err: errors.New("connection refused"), want: Failure},
+		{name: "cancelled", err: &url.Error{Op: "Get", URL: "/", Err: context.Canceled}, want: Ignore},
+		{name: "client timeout", err: &url.Error{Op: "Get", URL: "/", Err: clientTimeout{}}, want: Failure},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultFailurePolicy(tt.status, tt.err); got != tt.want {
+			t.Errorf("%s: DefaultFailurePolicy = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatusPolicy(t *testing.T) {
+	policy := StatusPolicy(map[int]Outcome{
+		http.StatusConflict:           Failure,
+		http.StatusServiceUnavailable: Ignore,
+	}, DefaultFailurePolicy)
+
+	tests := []struct {
+		status int
+		err    error
+		want   Outcome
+	}{
+		{status: http.StatusOK, want: Success},
+		{status: http.StatusConflict, want: Failure},
+		{status: http.StatusServiceUnavailable, want: Ignore},
+		{status: http.StatusInternalServerError, want: Failure},
+		{err: errors.New("connection refused"), want: Failure},
+	}
+
+	for _, tt := range tests {
+		if got := policy(tt.status, tt.err); got != tt.want {
+			t.Errorf("StatusPolicy(%d, %v) = %s, want %s", tt.status, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+		err    error
+		want   error
+	}{
+		{name: "success", ctx: context.Background(), status: http.StatusOK},
+		{name: "ignored", ctx: context.Background(), status: http.StatusTooManyRequests, want: context.Canceled},
+		{name: "failed response", ctx: context.Background(), status: http.StatusBadGateway, want: errors.New("TestClassify responded 502")},
+		{name: "error", ctx: context.Background(), err: errors.New("connection refused"), want: errors.New("connection refused")},
+		{name: "caller cancelled", ctx: cancelled, err: errors.New("broken pipe"), want: context.Canceled},
+		{
+			name: "caller's deadline passed",
+			ctx:  expired,
+			err:  &url.Error{Op: "Get", URL: "/", Err: context.DeadlineExceeded},
+			want: context.Canceled,
+		},
+		{name: "caller's deadline passed after a 500", ctx: expired, status: http.StatusInternalServerError, want: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		got := classify(tt.ctx, "TestClassify", tt.status, tt.err)
+		if (got == nil) != (tt.want == nil) || got != nil && got.Error() != tt.want.Error() {
+			t.Errorf("%s: classify = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package hystrix
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fallback serves the requests which the circuit breaker fails, because
+// the circuit is open, the command timed out or too many requests are
+// in flight.
+type Fallback interface {
+	Serve(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// FallbackFunc is a Fallback function.
+type FallbackFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+func (f FallbackFunc) Serve(w http.ResponseWriter, r *http.Request, err error) {
+	f(w, r, err)
+}
+
+// namedFallback is a fallback of this package, which reports the name,
+// for metrics, of the fallback which served the request
+type namedFallback interface {
+	serve(w http.ResponseWriter, r *http.Request, err error) string
+}
+
+// serveFallback serves the request with f, returning f's name
+func serveFallback(f Fallback, w http.ResponseWriter, r *http.Request, err error) string {
+	if n, ok := f.(namedFallback); ok {
+		return n.serve(w, r, err)
+	}
+	f.Serve(w, r, err)
+	return "custom"
+}
+
+func writeResponse(w http.ResponseWriter, header http.Header, status int, body []byte) {
+	for k, v := range header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+type staticFallback struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// StaticFallback responds with the given status, headers & body.
+func StaticFallback(status int, header http.Header, body []byte) Fallback {
+	return &staticFallback{status: status, header: header, body: body}
+}
+
+func (f *staticFallback) Serve(w http.ResponseWriter, r *http.Request, err error) {
+	f.serve(w, r, err)
+}
+
+func (f *staticFallback) serve(w http.ResponseWriter, r *http.Request, err error) string {
+	writeResponse(w, f.header, f.status, f.body)
+	return "static"
+}
+
+type handlerFallback struct {
+	h http.Handler
+}
+
+// HandlerFallback serves the requests with h.
+func HandlerFallback(h http.Handler) Fallback {
+	return &handlerFallback{h: h}
+}
+
+func (f *handlerFallback) Serve(w http.ResponseWriter, r *http.Request, err error) {
+	f.serve(w, r, err)
+}
+
+func (f *handlerFallback) serve(w http.ResponseWriter, r *http.Request, err error) string {
+	f.h.ServeHTTP(w, r)
+	return "handler"
+}
+
+type unavailableFallback struct {
+	retryAfter time.Duration
+}
+
+// UnavailableFallback responds 503 (Service Unavailable) with an RFC 7807
+// application/problem+json body and, unless retryAfter is zero, a
+// Retry-After header.  It is the default fallback, with the command's
+// sleep window as retryAfter.
+func UnavailableFallback(retryAfter time.Duration) Fallback {
+	return &unavailableFallback{retryAfter: retryAfter}
+}
+
+// problem is an RFC 7807 problem detail
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (f *unavailableFallback) Serve(w http.ResponseWriter, r *http.Request, err error) {
+	f.serve(w, r, err)
+}
+
+func (f *unavailableFallback) serve(w http.ResponseWriter, r *http.Request, err error) string {
+	if f.retryAfter > 0 {
+		// rounded up, so clients never retry early
+		seconds := (f.retryAfter + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.Itoa(int(seconds)))
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	p := problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusServiceUnavailable),
+		Status: http.StatusServiceUnavailable,
+	}
+	if err != nil {
+		p.Detail = err.Error()
+	}
+	json.NewEncoder(w).Encode(p)
+
+	return "unavailable"
+}
+
+type cachedResponse struct {
+	uri    string
+	header http.Header
+	vary   []string // the request headers the response varies by
+	body   []byte
+	stored time.Time
+}
+
+// cachedFallback serves the last good response to a GET of the same URL
+type cachedFallback struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxAge     time.Duration
+	entries    map[string]*list.Element
+	lru        *list.List // of *cachedResponse, most recently stored first
+	otherwise  Fallback
+}
+
+// CachedFallback serves the last 200 (OK) response to a GET of the same
+// URL, up to maxAge old, remembering the responses to at most
+// maxEntries URLs; otherwise, the request is served by the otherwise
+// fallback, e.g. UnavailableFallback(5 * time.Second).  Responses are
+// keyed by URL alone, so requests with credentials (Authorization or
+// Cookie headers) or with a header named by the response's Vary, &
+// responses which set cookies or are marked private or no-store, are
+// not cached.
+func CachedFallback(maxEntries int, maxAge time.Duration, otherwise Fallback) (Fallback, error) {
+	if maxEntries < 1 {
+		return nil, fmt.Errorf("hystrix.CachedFallback requires at least 1 entry, not %d", maxEntries)
+	}
+	if maxAge <= 0 {
+		return nil, fmt.Errorf("hystrix.CachedFallback requires a positive maxAge, not %s", maxAge)
+	}
+	if otherwise == nil {
+		return nil, fmt.Errorf("hystrix.CachedFallback requires a non-nil otherwise Fallback")
+	}
+
+	return &cachedFallback{
+		maxEntries: maxEntries,
+		maxAge:     maxAge,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		otherwise:  otherwise,
+	}, nil
+}
+
+// cacheable is true for GETs without credentials
+func cacheable(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		len(r.Header.Get("Authorization")) == 0 &&
+		len(r.Header.Get("Cookie")) == 0
+}
+
+// varies returns the request headers named by a Vary header, & whether
+// the request has any of them, or the response varies by anything ("*")
+func varies(r *http.Request, header http.Header) ([]string, bool) {
+	var names []string
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			switch {
+			case len(name) == 0:
+				continue
+			case name == "*":
+				return nil, true
+			case len(r.Header[name]) > 0:
+				return nil, true
+			}
+			names = append(names, name)
+		}
+	}
+	return names, false
+}
+
+// record remembers a good response
+func (f *cachedFallback) record(r *http.Request, status int, header http.Header, body []byte) {
+	if !cacheable(r) || status != http.StatusOK {
+		return
+	}
+	cc := strings.ToLower(header.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return
+	}
+	if len(header["Set-Cookie"]) > 0 {
+		return
+	}
+	vary, varied := varies(r, header)
+	if varied {
+		return
+	}
+
+	entry := &cachedResponse{
+		uri:    r.URL.RequestURI(),
+		vary:   vary,
+		header: make(http.Header, len(header)),
+		body:   append([]byte(nil), body...),
+		stored: time.Now(),
+	}
+	for k, v := range header {
+		entry.header[k] = append([]string(nil), v...)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if e, ok := f.entries[entry.uri]; ok {
+		f.lru.Remove(e)
+	}
+	f.entries[entry.uri] = f.lru.PushFront(entry)
+
+	for f.lru.Len() > f.maxEntries {
+		oldest := f.lru.Back()
+		f.lru.Remove(oldest)
+		delete(f.entries, oldest.Value.(*cachedResponse).uri)
+	}
+}
+
+// lookup returns the response, if any, cached for the request
+func (f *cachedFallback) lookup(r *http.Request) *cachedResponse {
+	if !cacheable(r) {
+		return nil
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	e, ok := f.entries[r.URL.RequestURI()]
+	if !ok {
+		return nil
+	}
+	entry := e.Value.(*cachedResponse)
+	if time.Since(entry.stored) > f.maxAge {
+		f.lru.Remove(e)
+		delete(f.entries, entry.uri)
+		return nil
+	}
+
+	// the cached response is for requests without these headers
+	for _, name := range entry.vary {
+		if len(r.Header[name]) > 0 {
+			return nil
+		}
+	}
+	return entry
+}
+
+func (f *cachedFallback) Serve(w http.ResponseWriter, r *http.Request, err error) {
+	f.serve(w, r, err)
+}
+
+func (f *cachedFallback) serve(w http.ResponseWriter, r *http.Request, err error) string {
+	entry := f.lookup(r)
+	if entry == nil {
+		return serveFallback(f.otherwise, w, r, err)
+	}
+
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.stored)/time.Second)))
+	writeResponse(w, entry.header, http.StatusOK, entry.body)
+	return "cached"
+}
+
+// recorder is a fallback which remembers good responses
+type recorder interface {
+	record(r *http.Request, status int, header http.Header, body []byte)
+}
+
+// fallbackReason labels the circuit breaker's error for metrics
+func fallbackReason(err error) string {
+	switch err {
+	case ErrCircuitOpen:
+		return "open"
+	case ErrTimeout:
+		return "timeout"
+	case ErrMaxConcurrency:
+		return "rejected"
+	case context.Canceled, context.DeadlineExceeded:
+		return "canceled"
+	}
+	return "error"
+}
@@ -0,0 +1,177 @@
+package hystrix
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCachedFallbackRecord(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		requestHeader  http.Header
+		status         int
+		responseHeader http.Header
+		lookupHeader   http.Header
+		cached         bool
+	}{
+		{name: "GET", method: http.MethodGet, status: http.StatusOK, cached: true},
+		{name: "POST", method: http.MethodPost, status: http.StatusOK},
+		{name: "not OK", method: http.MethodGet, status: http.StatusNotFound},
+		{
+			name:          "Authorization",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"Authorization": {"Bearer secret"}},
+			status:        http.StatusOK,
+		},
+		{
+			name:          "Cookie",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"Cookie": {"session=secret"}},
+			status:        http.StatusOK,
+		},
+		{
+			name:           "Set-Cookie",
+			method:         http.MethodGet,
+			status:         http.StatusOK,
+			responseHeader: http.Header{"Set-Cookie": {"session=secret"}},
+		},
+		{
+			name:           "private",
+			method:         http.MethodGet,
+			status:         http.StatusOK,
+			responseHeader: http.Header{"Cache-Control": {"private, max-age=60"}},
+		},
+		{
+			name:           "no-store",
+			method:         http.MethodGet,
+			status:         http.StatusOK,
+			responseHeader: http.Header{"Cache-Control": {"no-store"}},
+		},
+		{
+			name:           "Vary *",
+			method:         http.MethodGet,
+			status:         http.StatusOK,
+			responseHeader: http.Header{"Vary": {"*"}},
+		},
+		{
+			name:           "varies by a request header",
+			method:         http.MethodGet,
+			requestHeader:  http.Header{"Accept-Language": {"fr"}},
+			status:         http.StatusOK,
+			responseHeader: http.Header{"Vary": {"Accept-Encoding, accept-language"}},
+		},
+		{
+			name:           "varies by an absent request header",
+			method:         http.MethodGet,
+			status:         http.StatusOK,
+			responseHeader: http.Header{"Vary": {"Accept-Language"}},
+			cached:         true,
+		},
+		{
+			name:           "looked up with a header it varies by",
+			method:         http.MethodGet,
+			status:         http.StatusOK,
+			responseHeader: http.Header{"Vary": {"Accept-Language"}},
+			lookupHeader:   http.Header{"Accept-Language": {"fr"}},
+		},
+		{
+			name:         "looked up with a cookie",
+			method:       http.MethodGet,
+			status:       http.StatusOK,
+			lookupHeader: http.Header{"Cookie": {"session=other"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := CachedFallback(10, time.Minute, UnavailableFallback(0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache := f.(*cachedFallback)
+
+			r := httptest.NewRequest(tt.method, "/things?id=1", nil)
+			for k, v := range tt.requestHeader {
+				r.Header[k] = v
+			}
+			cache.record(r, tt.status, tt.responseHeader, []byte("body"))
+
+			lookup := httptest.NewRequest(http.MethodGet, "/things?id=1", nil)
+			for k, v := range tt.lookupHeader {
+				lookup.Header[k] = v
+			}
+			if cached := cache.lookup(lookup) != nil; cached != tt.cached {
+				t.Errorf("cached = %t, want %t", cached, tt.cached)
+			}
+		})
+	}
+}
+
+func TestCachedFallbackServe(t *testing.T) {
+	f, err := CachedFallback(1, time.Minute, StaticFallback(http.StatusTeapot, nil, []byte("static")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := f.(*cachedFallback)
+
+	for _, uri := range []string{"/a", "/b"} {
+		header := http.Header{"Content-Type": {"text/plain"}}
+		cache.record(httptest.NewRequest(http.MethodGet, uri, nil), http.StatusOK, header, []byte(uri))
+	}
+
+	tests := []struct {
+		uri      string
+		status   int
+		body     string
+		fallback string
+	}{
+		{uri: "/a", status: http.StatusTeapot, body: "static", fallback: "static"}, // evicted by /b
+		{uri: "/b", status: http.StatusOK, body: "/b", fallback: "cached"},
+		{uri: "/c", status: http.StatusTeapot, body: "static", fallback: "static"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			name := serveFallback(f, w, httptest.NewRequest(http.MethodGet, tt.uri, nil), ErrCircuitOpen)
+
+			if name != tt.fallback {
+				t.Errorf("fallback = %q, want %q", name, tt.fallback)
+			}
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Body.String(), tt.status, tt.body)
+			}
+		})
+	}
+}
+
+func TestUnavailableFallback(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		header     string
+	}{
+		{retryAfter: 0, header: ""},
+		{retryAfter: 5 * time.Second, header: "5"},
+		{retryAfter: 1500 * time.Millisecond, header: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.retryAfter.String(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			UnavailableFallback(tt.retryAfter).Serve(w, httptest.NewRequest(http.MethodGet, "/", nil), ErrCircuitOpen)
+
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d", w.Code)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.header {
+				t.Errorf("Retry-After = %q, want %q", got, tt.header)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+		})
+	}
+}
@@ -1,45 +1,147 @@
 package hystrix
 
 import (
-	"fmt"
+	"context"
 	"net/http"
+	"time"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/afex/hystrix-go/hystrix"
-	"github.com/mchudgins/go-service-helper/httpWriter"
+	"github.com/mchudgins/go-service-helper/logger"
 )
 
 type hystrixHelper struct {
 	commandName string
+	*circuitMetrics
 }
 
-func NewHystrixHelper(commandName string) (*hystrixHelper, error) {
-	hystrix.ConfigureCommand(commandName, hystrix.CommandConfig{
-		MaxConcurrentRequests: 100,
-	})
-	return &hystrixHelper{commandName: commandName}, nil
+// NewHystrixHelper returns middleware whose requests pass through the
+// named circuit breaker, configured by the options.  Unless configured
+// already, e.g. by LoadFile, the circuit allows 100 concurrent requests.
+// Its metrics are registered per the command's CommandMetrics.
+func NewHystrixHelper(commandName string, opts ...CommandOption) (*hystrixHelper, error) {
+	if !configured(commandName) {
+		opts = append([]CommandOption{MaxConcurrentRequests(100)}, opts...)
+	}
+	if err := Configure(commandName, opts...); err != nil {
+		return nil, err
+	}
+
+	commandsMutex.Lock()
+	cfg := commands[commandName].Metrics
+	commandsMutex.Unlock()
+
+	var m *hystrixMetrics
+	var err error
+	if cfg == nil {
+		m, err = getDefaultMetrics()
+	} else {
+		m, err = newHystrixMetrics(cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &hystrixHelper{
+		commandName:    commandName,
+		circuitMetrics: &circuitMetrics{circuit: commandName, metrics: m},
+	}, nil
 }
 
+// Handler passes requests through the circuit breaker, whose command's
+// FailurePolicy classifies the responses.  Requests which the breaker
+// fails, e.g. because the circuit is open, are served by the command's
+// Fallback.  Responses pass through as they are written, so handlers
+// may stream, flush & hijack; however, once a handler has begun its
+// response the fallback can no longer be served, so a handler which
+// times out after that is left to finish.
 func (y *hystrixHelper) Handler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		err := hystrix.Do(y.commandName, func() (err error) {
+		// cancelled once the response is sent, should the breaker give
+		// up on the handler
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		_, recording := commandFallback(y.commandName).(recorder)
+		rw := newResponseWriter(w, recording)
 
-			monitor := httpWriter.NewHTTPWriter(w)
+		// buffered, so the handler never blocks once abandoned
+		done := make(chan struct{}, 1)
 
-			h.ServeHTTP(monitor, r)
+		errc := hystrix.GoC(ctx, y.commandName, func(ctx context.Context) error {
+			h.ServeHTTP(rw, r)
+			done <- struct{}{}
 
-			rc := monitor.StatusCode()
-			if rc >= 500 && rc < 600 {
-				//log.Printf("StatusCode indicates backend failure")
-				return fmt.Errorf("failure contacting %s", y.commandName)
+			return classify(r.Context(), y.commandName, rw.StatusCode(), nil)
+		}, nil)
+
+		select {
+		case <-done:
+			y.finish(r, rw)
+
+		case err := <-errc:
+			// the handler may have completed, yet been classified as a
+			// failure (e.g. a 503) or ignored
+			select {
+			case <-done:
+				y.finish(r, rw)
+				return
+			default:
 			}
-			return nil
-		}, func(err error) error {
-			log.WithError(err).WithField("hystrix command", y.commandName).Warn("breaker open")
-			return nil
-		})
-		if err != nil {
-			log.WithError(err).WithField("hystrix command", y.commandName).Error("Error")
+
+			if rw.abandon() {
+				y.fallback(w, r, err)
+				return
+			}
+
+			// the handler has begun its response, so must finish it
+			<-done
+			y.finish(r, rw)
 		}
 	})
 }
+
+// finish completes the handler's response, which the fallback may
+// remember
+func (y *hystrixHelper) finish(r *http.Request, rw *responseWriter) {
+	status, header, body, recorded := rw.finish()
+	if !recorded {
+		return
+	}
+	if rec, ok := commandFallback(y.commandName).(recorder); ok {
+		rec.record(r, status, header, body)
+	}
+}
+
+func (y *hystrixHelper) fallback(w http.ResponseWriter, r *http.Request, err error) {
+	// nobody is waiting for a response
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return
+	}
+
+	reason := fallbackReason(err)
+	logger.FromContext(r.Context()).Warn("circuit breaker failed the request; serving the fallback",
+		logger.Err(err),
+		logger.String("hystrix command", y.commandName),
+		logger.String("reason", reason))
+
+	name := serveFallback(commandFallback(y.commandName), w, r, err)
+	y.metrics.fallbacks.WithLabelValues(y.commandName, name, reason).Inc()
+}
+
+// commandFallback returns the command's fallback, by default a 503
+// whose Retry-After is the circuit's sleep window
+func commandFallback(commandName string) Fallback {
+	commandsMutex.Lock()
+	f := commands[commandName].Fallback
+	commandsMutex.Unlock()
+	if f != nil {
+		return f
+	}
+
+	sleepWindow := time.Duration(hystrix.DefaultSleepWindow) * time.Millisecond
+	if s, ok := hystrix.GetCircuitSettings()[commandName]; ok && s != nil && s.SleepWindow > 0 {
+		sleepWindow = s.SleepWindow
+	}
+	return UnavailableFallback(sleepWindow)
+}
@@ -1,159 +1,189 @@
 package hystrix
 
 import (
+	"sync"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/afex/hystrix-go/hystrix/metric_collector"
+	"github.com/mchudgins/go-service-helper/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// hystrixMetrics are the circuit breaker metrics, labelled by circuit
+type hystrixMetrics struct {
+	attempts          *prometheus.CounterVec
+	errors            *prometheus.CounterVec
+	successes         *prometheus.CounterVec
+	failures          *prometheus.CounterVec
+	rejects           *prometheus.CounterVec
+	shortCircuits     *prometheus.CounterVec
+	timeouts          *prometheus.CounterVec
+	fallbackSuccesses *prometheus.CounterVec
+	fallbackFailures  *prometheus.CounterVec
+	totalDuration     *prometheus.CounterVec
+	runDuration       *prometheus.CounterVec
+	fallbacks         *prometheus.CounterVec // served by hystrixHelper.Handler
+}
+
+func newHystrixMetrics(cfg *metrics.Config) (*hystrixMetrics, error) {
+	m := &hystrixMetrics{}
+
+	for _, c := range []struct {
+		counter    **prometheus.CounterVec
+		name, help string
+	}{
+		{&m.attempts, "hystrix_attempts_total", "Number of attempts to cross the circuit breaker."},
+		{&m.errors, "hystrix_errors_total", "Number of errors when crossing the circuit breaker."},
+		{&m.successes, "hystrix_successes_total", "Number of successful requests."},
+		{&m.failures, "hystrix_failures_total", "Number of failed requests."},
+		{&m.rejects, "hystrix_rejects_total", "Number of rejected requests."},
+		{&m.shortCircuits, "hystrix_short_circuits_total", "Number of short circuited requests (the circuit breaker was open at time of request)."},
+		{&m.timeouts, "hystrix_timeouts_total", "Number of requests which timeout."},
+		{&m.fallbackSuccesses, "hystrix_fallback_successes_total", "Number of successes that occurred during the execution of the fallback function."},
+		{&m.fallbackFailures, "hystrix_fallback_failures_total", "Number of failures that occurred during the execution of the fallback function."},
+		{&m.totalDuration, "hystrix_duration_total", "Duration in circuit breaker."},
+		{&m.runDuration, "hystrix_run_duration", "runtime duration."},
+	} {
+		// a second registration shares the metrics already registered
+		collector, err := cfg.Register(prometheus.NewCounterVec(cfg.CounterOpts(c.name, c.help), []string{"circuit"}))
+		if err != nil {
+			return nil, err
+		}
+		*c.counter = collector.(*prometheus.CounterVec)
+	}
+
+	collector, err := cfg.Register(prometheus.NewCounterVec(
+		cfg.CounterOpts("hystrix_fallbacks_total", "Number of requests served by a fallback, by fallback & the reason the circuit breaker failed them."),
+		[]string{"circuit", "fallback", "reason"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	m.fallbacks = collector.(*prometheus.CounterVec)
+
+	return m, nil
+}
+
 var (
-	hystrixAttempts = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_attempts_total",
-			Help: "Number of attempts to cross the circuit breaker.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixErrors = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_errors_total",
-			Help: "Number of errors when crossing the circuit breaker.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixSuccesses = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_successes_total",
-			Help: "Number of successful requests.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixFailures = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_failures_total",
-			Help: "Number of failed requests.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixRejects = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_rejects_total",
-			Help: "Number of rejected requests.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixShortCircuits = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_short_circuits_total",
-			Help: "Number of short circuited requests (the circuit breaker was open at time of request).",
-		},
-		[]string{"circuit"},
-	)
-	hystrixTimeouts = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_timeouts_total",
-			Help: "Number of requests which timeout.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixFallbackSuccesses = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_fallback_successes_total",
-			Help: "Number of successes that occurred during the execution of the fallback function.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixFallbackFailures = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_fallback_failures_total",
-			Help: "Number of failures that occurred during the execution of the fallback function.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixTotalDuration = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_duration_total",
-			Help: "Duration in circuit breaker.",
-		},
-		[]string{"circuit"},
-	)
-	hystrixRunDuration = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "hystrix_run_duration",
-			Help: "runtime duration.",
-		},
-		[]string{"circuit"},
-	)
+	defaultMetricsOnce sync.Once
+	defaultMetrics     *hystrixMetrics
+	defaultMetricsErr  error
 )
 
-func init() {
-	prometheus.MustRegister(hystrixAttempts)
-	prometheus.MustRegister(hystrixErrors)
-	prometheus.MustRegister(hystrixSuccesses)
-	prometheus.MustRegister(hystrixFailures)
-	prometheus.MustRegister(hystrixRejects)
-	prometheus.MustRegister(hystrixShortCircuits)
-	prometheus.MustRegister(hystrixTimeouts)
-	prometheus.MustRegister(hystrixFallbackSuccesses)
-	prometheus.MustRegister(hystrixFallbackFailures)
-	prometheus.MustRegister(hystrixTotalDuration)
-	prometheus.MustRegister(hystrixRunDuration)
+// registered with metrics.Default() on first use, rather than on import
+func getDefaultMetrics() (*hystrixMetrics, error) {
+	defaultMetricsOnce.Do(func() {
+		defaultMetrics, defaultMetricsErr = newHystrixMetrics(metrics.Default())
+	})
+	return defaultMetrics, defaultMetricsErr
+}
+
+var (
+	registeredMutex sync.Mutex
+	registered      = make(map[*prometheus.CounterVec]bool) // keyed by the attempts counter
+)
+
+// RegisterMetrics exports the metrics of every circuit breaker, per cfg.
+// Call it before running any commands; calling it again with the same
+// registry has no effect.  The fallbacks served by NewHystrixHelper's
+// Handler are counted per the command's CommandMetrics.
+func RegisterMetrics(cfg *metrics.Config) error {
+	m, err := newHystrixMetrics(cfg)
+	if err != nil {
+		return err
+	}
+
+	registeredMutex.Lock()
+	defer registeredMutex.Unlock()
+
+	// the registry returns the counters already registered, so each
+	// registry need only be added to hystrix once
+	if registered[m.attempts] {
+		return nil
+	}
+	registered[m.attempts] = true
+
+	metricCollector.Registry.Register(func(name string) metricCollector.MetricCollector {
+		return &circuitMetrics{circuit: name, metrics: m}
+	})
+
+	return nil
+}
+
+// circuitMetrics is a hystrix MetricCollector for a single circuit
+type circuitMetrics struct {
+	circuit string
+	metrics *hystrixMetrics
+}
+
+func (c *circuitMetrics) labels() prometheus.Labels {
+	return prometheus.Labels{"circuit": c.circuit}
 }
 
-func (h *hystrixHelper) IncrementAttempts() {
-	hystrixAttempts.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementAttempts() {
+	c.metrics.attempts.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) IncrementErrors() {
-	hystrixErrors.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementErrors() {
+	c.metrics.errors.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) IncrementSuccesses() {
-	hystrixSuccesses.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementSuccesses() {
+	c.metrics.successes.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) IncrementFailures() {
-	hystrixFailures.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementFailures() {
+	c.metrics.failures.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) IncrementRejects() {
-	hystrixRejects.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementRejects() {
+	c.metrics.rejects.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) IncrementShortCircuits() {
-	hystrixShortCircuits.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementShortCircuits() {
+	c.metrics.shortCircuits.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) IncrementTimeouts() {
-	hystrixTimeouts.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementTimeouts() {
+	c.metrics.timeouts.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) IncrementFallbackSuccesses() {
-	hystrixFallbackSuccesses.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementFallbackSuccesses() {
+	c.metrics.fallbackSuccesses.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) IncrementFallbackFailures() {
-	hystrixFallbackFailures.With(prometheus.Labels{"circuit": h.commandName}).Inc()
+func (c *circuitMetrics) IncrementFallbackFailures() {
+	c.metrics.fallbackFailures.With(c.labels()).Inc()
 }
 
-func (h *hystrixHelper) UpdateTotalDuration(timeSinceStart time.Duration) {
-	hystrixTotalDuration.With(prometheus.Labels{"circuit": h.commandName}).Add(float64(timeSinceStart))
+func (c *circuitMetrics) UpdateTotalDuration(timeSinceStart time.Duration) {
+	c.metrics.totalDuration.With(c.labels()).Add(float64(timeSinceStart))
 }
 
-func (h *hystrixHelper) UpdateRunDuration(runDuration time.Duration) {
-	hystrixRunDuration.With(prometheus.Labels{"circuit": h.commandName}).Add(float64(runDuration))
+func (c *circuitMetrics) UpdateRunDuration(runDuration time.Duration) {
+	c.metrics.runDuration.With(c.labels()).Add(float64(runDuration))
 }
 
-func (h *hystrixHelper) Reset() {
-	log.Debug("HystrixHelper reset called")
+func (c *circuitMetrics) Reset() {
 }
 
-func (h *hystrixHelper) Update(mr metricCollector.MetricResult) {
-	log.Debug("HystrixHelper.Update called")
+// Update records the result of a command
+func (c *circuitMetrics) Update(mr metricCollector.MetricResult) {
+	labels := c.labels()
+
+	c.metrics.attempts.With(labels).Add(mr.Attempts)
+	c.metrics.errors.With(labels).Add(mr.Errors)
+	c.metrics.successes.With(labels).Add(mr.Successes)
+	c.metrics.failures.With(labels).Add(mr.Failures)
+	c.metrics.rejects.With(labels).Add(mr.Rejects)
+	c.metrics.shortCircuits.With(labels).Add(mr.ShortCircuits)
+	c.metrics.timeouts.With(labels).Add(mr.Timeouts)
+	c.metrics.fallbackSuccesses.With(labels).Add(mr.FallbackSuccesses)
+	c.metrics.fallbackFailures.With(labels).Add(mr.FallbackFailures)
+	c.metrics.totalDuration.With(labels).Add(float64(mr.TotalDuration))
+	c.metrics.runDuration.With(labels).Add(float64(mr.RunDuration))
 }
 
 func (h *hystrixHelper) NewPrometheusCollector(name string) metricCollector.MetricCollector {
-	return h
+	return &circuitMetrics{circuit: name, metrics: h.metrics}
 }
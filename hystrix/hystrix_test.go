@@ -0,0 +1,207 @@
+package hystrix
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandler(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		body    string
+		flushed bool
+		header  bool // the handler's header was sent
+	}{
+		{
+			name: "passes the response through",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Handler", "yes")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("created"))
+			},
+			status: http.StatusCreated,
+			body:   "created",
+			header: true,
+		},
+		{
+			name: "streams",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("part 1;"))
+				w.(http.Flusher).Flush()
+				w.Write([]byte("part 2"))
+			},
+			status:  http.StatusOK,
+			body:    "part 1;part 2",
+			flushed: true,
+		},
+		{
+			name: "writes nothing",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Handler", "yes")
+			},
+			status: http.StatusOK,
+			header: true,
+		},
+		{
+			name: "times out before responding",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(2 * timeout)
+				w.Write([]byte("too late"))
+			},
+			status: http.StatusTeapot,
+			body:   "fallback",
+		},
+		{
+			name: "times out after responding",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("begun;"))
+				time.Sleep(2 * timeout)
+				w.Write([]byte("finished"))
+			},
+			status: http.StatusOK,
+			body:   "begun;finished",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			y, err := NewHystrixHelper("TestHandler "+tt.name,
+				Timeout(timeout),
+				WithFallback(StaticFallback(http.StatusTeapot, nil, []byte("fallback"))))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			y.Handler(tt.handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Body.String(), tt.status, tt.body)
+			}
+			if w.Flushed != tt.flushed {
+				t.Errorf("flushed = %t, want %t", w.Flushed, tt.flushed)
+			}
+			if header := w.Header().Get("X-Handler") == "yes"; header != tt.header {
+				t.Errorf("header sent = %t, want %t", header, tt.header)
+			}
+		})
+	}
+}
+
+func TestHandlerCachedFallback(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	cached, err := CachedFallback(10, time.Minute, UnavailableFallback(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := NewHystrixHelper("TestHandlerCachedFallback", Timeout(timeout), WithFallback(cached))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow := make(chan bool, 1)
+	h := y.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if <-slow {
+			time.Sleep(2 * timeout)
+		}
+		w.Write([]byte("good"))
+	}))
+
+	tests := []struct {
+		name   string
+		slow   bool
+		status int
+		body   string
+	}{
+		{name: "good", status: http.StatusOK, body: "good"},
+		{name: "timeout serves the cached response", slow: true, status: http.StatusOK, body: "good"},
+	}
+
+	for _, tt := range tests {
+		slow <- tt.slow
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cached", nil))
+
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Errorf("%s: response = %d %q, want %d %q", tt.name, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+// fallbacks returns the number of fallbacks served for the circuit, as
+// gathered from g
+func fallbacks(t *testing.T, g prometheus.Gatherer, circuit string) float64 {
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n float64
+	for _, family := range families {
+		if family.GetName() != "hystrix_fallbacks_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "circuit" && label.GetValue() == circuit {
+					n += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return n
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	const timeout = 10 * time.Millisecond
+
+	registry := prometheus.NewRegistry()
+	cfg, err := metrics.New(metrics.Registry(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		opts            []CommandOption
+		private, global float64 // fallbacks counted by each registry
+	}{
+		{name: "default", global: 1},
+		{name: "CommandMetrics", opts: []CommandOption{CommandMetrics(cfg)}, private: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			circuit := "TestHandlerMetrics " + tt.name
+			y, err := NewHystrixHelper(circuit, append(tt.opts, Timeout(timeout))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			y.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(2 * timeout)
+			})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if n := fallbacks(t, registry, circuit); n != tt.private {
+				t.Errorf("private registry counted %v fallbacks, want %v", n, tt.private)
+			}
+			if n := fallbacks(t, prometheus.DefaultGatherer, circuit); n != tt.global {
+				t.Errorf("default registry counted %v fallbacks, want %v", n, tt.global)
+			}
+		})
+	}
+
+	if _, err := NewHystrixHelper("TestHandlerMetrics nil", CommandMetrics(nil)); err == nil {
+		t.Error("NewHystrixHelper(CommandMetrics(nil)) succeeded, want an error")
+	}
+}
@@ -0,0 +1,162 @@
+package hystrix
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// maxRecordedBody is the largest response body remembered for a
+// CachedFallback
+const maxRecordedBody = 1 << 20
+
+// responseWriter passes a handler's response through to the client once
+// the handler begins it, i.e. writes the status or body, flushes or
+// hijacks the connection.  Until then, the circuit breaker may abandon
+// the handler & serve the fallback instead; the handler's writes are
+// then discarded.
+type responseWriter struct {
+	mutex     sync.Mutex
+	w         http.ResponseWriter
+	header    http.Header // the handler's headers, until the response begins
+	status    int
+	committed bool
+	abandoned bool
+
+	// a copy of the response for a CachedFallback, unless it is
+	// streamed or too large
+	recording bool
+	body      bytes.Buffer
+}
+
+func newResponseWriter(w http.ResponseWriter, recording bool) *responseWriter {
+	return &responseWriter{
+		w:         w,
+		header:    make(http.Header),
+		recording: recording,
+	}
+}
+
+func (rw *responseWriter) Header() http.Header {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	// once begun, trailers may be set
+	if rw.committed {
+		return rw.w.Header()
+	}
+	return rw.header
+}
+
+// commit begins the response; the caller holds the mutex
+func (rw *responseWriter) commit(status int) {
+	if rw.committed {
+		return
+	}
+	rw.committed = true
+	rw.status = status
+
+	for k, v := range rw.header {
+		rw.w.Header()[k] = v
+	}
+	rw.w.WriteHeader(status)
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if !rw.abandoned {
+		rw.commit(status)
+	}
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.abandoned {
+		return 0, http.ErrHandlerTimeout
+	}
+	rw.commit(http.StatusOK)
+
+	if rw.recording {
+		if rw.body.Len()+len(data) > maxRecordedBody {
+			rw.recording = false
+			rw.body = bytes.Buffer{}
+		} else {
+			rw.body.Write(data)
+		}
+	}
+
+	return rw.w.Write(data)
+}
+
+func (rw *responseWriter) Flush() {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.abandoned {
+		return
+	}
+	rw.commit(http.StatusOK)
+	rw.recording = false
+
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.abandoned {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	h, ok := rw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hystrix: the http.ResponseWriter does not support hijacking")
+	}
+
+	rw.committed = true
+	rw.recording = false
+	return h.Hijack()
+}
+
+// StatusCode is the status of the response, once begun
+func (rw *responseWriter) StatusCode() int {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// abandon stops passing the handler's response through, reporting
+// false if the response has already begun
+func (rw *responseWriter) abandon() bool {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if rw.committed {
+		return false
+	}
+	rw.abandoned = true
+	return true
+}
+
+// finish begins the response of a handler which completed without
+// writing anything, returning the response if it was recorded
+func (rw *responseWriter) finish() (status int, header http.Header, body []byte, recorded bool) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	rw.commit(http.StatusOK)
+	return rw.status, rw.header, rw.body.Bytes(), rw.recording
+}
@@ -0,0 +1,402 @@
+package hystrix
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RetryBudget limits retries to a fraction of requests, so that a
+// struggling dependency isn't overwhelmed by a storm of retries.
+type RetryBudget struct {
+	mutex        sync.Mutex
+	ratio        float64
+	minPerSecond float64
+	tokens       float64
+	max          float64
+	last         time.Time
+}
+
+// NewRetryBudget allows retries of up to ratio of requests, e.g. 0.2
+// for 20%, plus minPerSecond retries each second regardless of the
+// number of requests.  The budget starts with one second's minimum, and
+// a quiet period refills no more than that, so that it cannot fund a
+// burst of retries; unspent budget from requests is capped at a hundred
+// requests' ratio.
+func NewRetryBudget(ratio, minPerSecond float64) (*RetryBudget, error) {
+	if ratio < 0 {
+		return nil, fmt.Errorf("hystrix.NewRetryBudget requires a non-negative ratio, not %g", ratio)
+	}
+	if minPerSecond < 0 {
+		return nil, fmt.Errorf("hystrix.NewRetryBudget requires a non-negative minPerSecond, not %g", minPerSecond)
+	}
+
+	return &RetryBudget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		tokens:       minPerSecond,
+		max:          minPerSecond + 100*ratio,
+		last:         time.Now(),
+	}, nil
+}
+
+// refill adds the minimum allowed since the last call, up to one
+// second's worth; the caller holds the mutex
+func (b *RetryBudget) refill(now time.Time) {
+	if b.tokens < b.minPerSecond {
+		b.tokens += now.Sub(b.last).Seconds() * b.minPerSecond
+		if b.tokens > b.minPerSecond {
+			b.tokens = b.minPerSecond
+		}
+	}
+	b.last = now
+}
+
+// deposit records a request
+func (b *RetryBudget) deposit() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(time.Now())
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// withdraw reports whether a retry is allowed, spending the budget if so
+func (b *RetryBudget) withdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// DefaultRetryable retries transport errors, circuit breaker timeouts,
+// and 429, 502, 503 & 504 responses.  It doesn't retry requests which
+// the circuit breaker rejected without attempting them, or whose
+// context is done.
+func DefaultRetryable(status int, err error) bool {
+	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		switch err {
+		case ErrCircuitOpen, ErrMaxConcurrency, context.Canceled, context.DeadlineExceeded:
+			return false
+		}
+		return true
+	}
+
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RetryPolicy retries the requests of an HTTPClient.  Each attempt
+// passes through the circuit breaker, so each counts against it.
+type RetryPolicy struct {
+	maxAttempts int
+	initial     time.Duration
+	max         time.Duration
+	jitter      float64
+	methods     map[string]bool
+	retryable   func(status int, err error) bool
+	budget      *RetryBudget
+	metrics     *metrics.Config
+	attempts    *prometheus.CounterVec
+	retries     *prometheus.CounterVec
+	denied      *prometheus.CounterVec
+}
+
+type RetryOption func(*RetryPolicy) error
+
+// NewRetryPolicy returns a policy which, by default, makes up to 3
+// attempts of idempotent requests, backing off exponentially from
+// 100ms to 5s with 50% jitter, within a budget of 20% of requests plus
+// 10 retries a second.
+func NewRetryPolicy(opts ...RetryOption) (*RetryPolicy, error) {
+	p := &RetryPolicy{
+		maxAttempts: 3,
+		initial:     100 * time.Millisecond,
+		max:         5 * time.Second,
+		jitter:      0.5,
+		retryable:   DefaultRetryable,
+		metrics:     metrics.Default(),
+	}
+	RetryMethods(http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace)(p)
+
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.budget == nil {
+		p.budget, _ = NewRetryBudget(0.2, 10)
+	}
+
+	// a second policy shares the counters already registered
+	for _, c := range []struct {
+		counter    **prometheus.CounterVec
+		name, help string
+		labels     []string
+	}{
+		{&p.attempts, "hystrix_client_attempts_total", "Number of attempts, by result, to send a request.", []string{"circuit", "result"}},
+		{&p.retries, "hystrix_client_retries_total", "Number of requests retried.", []string{"circuit"}},
+		{&p.denied, "hystrix_client_retries_denied_total", "Number of retryable requests not retried, by reason.", []string{"circuit", "reason"}},
+	} {
+		collector, err := p.metrics.Register(prometheus.NewCounterVec(p.metrics.CounterOpts(c.name, c.help), c.labels))
+		if err != nil {
+			return nil, err
+		}
+		*c.counter = collector.(*prometheus.CounterVec)
+	}
+
+	return p, nil
+}
+
+// MaxAttempts limits the attempts, including the first, made of each
+// request.
+func MaxAttempts(n int) RetryOption {
+	return func(p *RetryPolicy) error {
+		if n < 1 {
+			return fmt.Errorf("hystrix.MaxAttempts requires at least 1 attempt, not %d", n)
+		}
+		p.maxAttempts = n
+		return nil
+	}
+}
+
+// Backoff waits initial before the first retry, doubling the wait for
+// each subsequent retry, up to max.  A Retry-After header longer than
+// max is not honored; the response is returned instead.
+func Backoff(initial, max time.Duration) RetryOption {
+	return func(p *RetryPolicy) error {
+		if initial <= 0 || max < initial {
+			return fmt.Errorf("hystrix.Backoff requires 0 < initial <= max, not %s & %s", initial, max)
+		}
+		p.initial = initial
+		p.max = max
+		return nil
+	}
+}
+
+// Jitter randomizes the given fraction, 0 to 1, of each wait.
+func Jitter(fraction float64) RetryOption {
+	return func(p *RetryPolicy) error {
+		if fraction < 0 || fraction > 1 {
+			return fmt.Errorf("hystrix.Jitter requires a fraction between 0 and 1, not %g", fraction)
+		}
+		p.jitter = fraction
+		return nil
+	}
+}
+
+// RetryMethods retries requests with the given methods only; by
+// default, the idempotent methods.
+func RetryMethods(methods ...string) RetryOption {
+	return func(p *RetryPolicy) error {
+		p.methods = make(map[string]bool, len(methods))
+		for _, m := range methods {
+			p.methods[m] = true
+		}
+		return nil
+	}
+}
+
+// RetryOn decides which results are retried, rather than
+// DefaultRetryable.
+func RetryOn(retryable func(status int, err error) bool) RetryOption {
+	return func(p *RetryPolicy) error {
+		if retryable == nil {
+			return fmt.Errorf("hystrix.RetryOn requires a non-nil function")
+		}
+		p.retryable = retryable
+		return nil
+	}
+}
+
+// WithRetryBudget spends b on retries; policies may share a budget.
+func WithRetryBudget(b *RetryBudget) RetryOption {
+	return func(p *RetryPolicy) error {
+		if b == nil {
+			return fmt.Errorf("hystrix.WithRetryBudget requires a non-nil RetryBudget")
+		}
+		p.budget = b
+		return nil
+	}
+}
+
+// RetryMetrics registers the retry counters per cfg; by default,
+// metrics.Default().
+func RetryMetrics(cfg *metrics.Config) RetryOption {
+	return func(p *RetryPolicy) error {
+		if cfg == nil {
+			return fmt.Errorf("hystrix.RetryMetrics requires a non-nil metrics.Config")
+		}
+		p.metrics = cfg
+		return nil
+	}
+}
+
+// backoff is the wait before the given retry, 1 being the first
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.initial
+	for i := 1; i < retry && d < p.max; i++ {
+		d *= 2
+	}
+	if d > p.max {
+		d = p.max
+	}
+
+	jitter := time.Duration(float64(d) * p.jitter)
+	return d - jitter + time.Duration(rand.Int63n(int64(jitter)+1))
+}
+
+// retryAfter parses a Retry-After header, either in seconds or an HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func statusOf(response *http.Response) int {
+	if response == nil {
+		return 0
+	}
+	return response.StatusCode
+}
+
+// do sends the request, retrying per the policy
+func (p *RetryPolicy) do(c *HTTPClient, r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	circuit := prometheus.Labels{"circuit": c.HystrixCommandName}
+
+	hasBody := r.Body != nil && r.Body != http.NoBody
+	retry := p.methods[r.Method] && (!hasBody || r.GetBody != nil)
+	p.budget.deposit()
+
+	for attempt := 1; ; attempt++ {
+		// a copy, so that each attempt has its own trace headers & body
+		req := r.Clone(ctx)
+		if attempt > 1 && hasBody {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		response, err := p.attempt(c, req, attempt)
+		if !retry || !p.retryable(statusOf(response), err) {
+			return response, err
+		}
+
+		wait := p.backoff(attempt)
+		var reason string
+		if response != nil {
+			if d, ok := retryAfter(response.Header.Get("Retry-After"), time.Now()); ok {
+				if d > p.max {
+					reason = "retry_after"
+				} else if d > wait {
+					wait = d
+				}
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			reason = "deadline"
+		}
+		switch {
+		case len(reason) > 0:
+		case attempt >= p.maxAttempts:
+			reason = "attempts"
+		case !p.budget.withdraw():
+			reason = "budget"
+		}
+		if len(reason) > 0 {
+			p.denied.With(prometheus.Labels{"circuit": c.HystrixCommandName, "reason": reason}).Inc()
+			return response, err
+		}
+
+		if response != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(response.Body, 4096))
+			response.Body.Close()
+		}
+		p.retries.With(circuit).Inc()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request via the circuit breaker, in a span of its
+// own if the request is traced
+func (p *RetryPolicy) attempt(c *HTTPClient, r *http.Request, n int) (*http.Response, error) {
+	var span opentracing.Span
+	if parent := opentracing.SpanFromContext(r.Context()); parent != nil {
+		span = parent.Tracer().StartSpan(c.HystrixCommandName, opentracing.ChildOf(parent.Context()))
+		defer span.Finish()
+
+		ext.SpanKindRPCClient.Set(span)
+		ext.HTTPMethod.Set(span, r.Method)
+		ext.HTTPUrl.Set(span, r.URL.String())
+		span.SetTag("attempt", n)
+
+		span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+		r = r.WithContext(opentracing.ContextWithSpan(r.Context(), span))
+	}
+
+	response, err := c.attempt(r)
+
+	result := "error"
+	if err == nil {
+		result = strconv.Itoa(response.StatusCode/100) + "xx"
+	}
+	p.attempts.With(prometheus.Labels{"circuit": c.HystrixCommandName, "result": result}).Inc()
+
+	if span != nil {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.SetTag("error.message", err.Error())
+		} else {
+			ext.HTTPStatusCode.Set(span, uint16(response.StatusCode))
+		}
+	}
+
+	return response, err
+}
@@ -0,0 +1,417 @@
+package hystrix
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBackoff(t *testing.T) {
+	const ms = time.Millisecond
+
+	tests := []struct {
+		retry    int
+		jitter   float64
+		min, max time.Duration
+	}{
+		{retry: 1, jitter: 0, min: 100 * ms, max: 100 * ms},
+		{retry: 2, jitter: 0, min: 200 * ms, max: 200 * ms},
+		{retry: 4, jitter: 0, min: 800 * ms, max: 800 * ms},
+		{retry: 5, jitter: 0, min: time.Second, max: time.Second}, // capped
+		{retry: 50, jitter: 0, min: time.Second, max: time.Second},
+		{retry: 1, jitter: 0.5, min: 50 * ms, max: 100 * ms},
+		{retry: 3, jitter: 0.5, min: 200 * ms, max: 400 * ms},
+		{retry: 9, jitter: 1, min: 0, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		p := &RetryPolicy{initial: 100 * ms, max: time.Second, jitter: tt.jitter}
+		for i := 0; i < 100; i++ {
+			if d := p.backoff(tt.retry); d < tt.min || d > tt.max {
+				t.Errorf("backoff(%d) with jitter %g = %s, want %s to %s", tt.retry, tt.jitter, d, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, time.October, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		wait  time.Duration
+		ok    bool
+	}{
+		{value: "", ok: false},
+		{value: "5", wait: 5 * time.Second, ok: true},
+		{value: "0", wait: 0, ok: true},
+		{value: "-1", ok: false},
+		{value: "soon", ok: false},
+		{value: now.Add(90 * time.Second).Format(http.TimeFormat), wait: 90 * time.Second, ok: true},
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), wait: 0, ok: true},
+	}
+
+	for _, tt := range tests {
+		wait, ok := retryAfter(tt.value, now)
+		if wait != tt.wait || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %t, want %s, %t", tt.value, wait, ok, tt.wait, tt.ok)
+		}
+	}
+}
+
+func TestDefaultRetryable(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   bool
+	}{
+		{name: "200", status: http.StatusOK, want: false},
+		{name: "404", status: http.StatusNotFound, want: false},
+		{name: "500", status: http.StatusInternalServerError, want: false},
+		{name: "429", status: http.StatusTooManyRequests, want: true},
+		{name: "502", status: http.StatusBadGateway, want: true},
+		{name: "503", status: http.StatusServiceUnavailable, want: true},
+		{name: "504", status: http.StatusGatewayTimeout, want: true},
+		{name: "connection refused", err: &url.Error{Op: "Get", URL: "/", Err: errors.New("connection refused")}, want: true},
+		{name: "breaker timeout", err: ErrTimeout, want: true},
+		{name: "circuit open", err: ErrCircuitOpen, want: false},
+		{name: "max concurrency", err: ErrMaxConcurrency, want: false},
+		{name: "cancelled", err: &url.Error{Op: "Get", URL: "/", Err: context.Canceled}, want: false},
+		{name: "deadline", err: context.DeadlineExceeded, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultRetryable(tt.status, tt.err); got != tt.want {
+			t.Errorf("%s: DefaultRetryable = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	// no minimum, so only requests fund retries; 10 tokens at most
+	b, err := NewRetryBudget(0.1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		deposits  int
+		withdraws int
+		allowed   int
+	}{
+		{name: "initial budget", withdraws: 1, allowed: 0},
+		{name: "funded by requests", deposits: 25, withdraws: 3, allowed: 2},
+		{name: "spent", withdraws: 1, allowed: 0},
+		{name: "capped", deposits: 1000, withdraws: 12, allowed: 10},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < tt.deposits; i++ {
+			b.deposit()
+		}
+		allowed := 0
+		for i := 0; i < tt.withdraws; i++ {
+			if b.withdraw() {
+				allowed++
+			}
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: %d retries allowed, want %d", tt.name, allowed, tt.allowed)
+		}
+	}
+
+	for _, args := range [][2]float64{{-0.1, 0}, {0, -1}} {
+		if _, err := NewRetryBudget(args[0], args[1]); err == nil {
+			t.Errorf("NewRetryBudget(%g, %g) succeeded, want an error", args[0], args[1])
+		}
+	}
+}
+
+func TestRetryBudgetBurst(t *testing.T) {
+	tests := []struct {
+		name         string
+		ratio        float64
+		minPerSecond float64
+		idle         time.Duration
+		allowed      int
+	}{
+		{name: "fresh", ratio: 0.2, minPerSecond: 10, allowed: 10},
+		{name: "idle", ratio: 0.2, minPerSecond: 10, idle: time.Hour, allowed: 10},
+		{name: "fresh, no minimum", ratio: 0.2, allowed: 0},
+		{name: "idle, no minimum", ratio: 0.2, idle: time.Hour, allowed: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewRetryBudget(tt.ratio, tt.minPerSecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.last = b.last.Add(-tt.idle)
+
+			allowed := 0
+			for i := 0; i < 100; i++ {
+				if b.withdraw() {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("%d retries allowed at once, want %d", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	exhausted, err := NewRetryBudget(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       []RetryOption
+		method     string
+		body       string
+		statuses   []int  // returned by successive attempts
+		retryAfter string // sent with each failure
+		timeout    time.Duration
+		attempts   int
+		status     int
+		denied     string // the reason a retryable request was not retried
+	}{
+		{name: "succeeds", method: http.MethodGet, statuses: []int{200}, attempts: 1, status: 200},
+		{name: "recovers", method: http.MethodGet, statuses: []int{503, 502, 200}, attempts: 3, status: 200},
+		{name: "attempts exhausted", method: http.MethodGet, statuses: []int{503, 503, 503}, attempts: 3, status: 503, denied: "attempts"},
+		{name: "MaxAttempts", opts: []RetryOption{MaxAttempts(1)}, method: http.MethodGet, statuses: []int{503}, attempts: 1, status: 503, denied: "attempts"},
+		{name: "not retryable", method: http.MethodGet, statuses: []int{500}, attempts: 1, status: 500},
+		{name: "not idempotent", method: http.MethodPost, body: "data", statuses: []int{503}, attempts: 1, status: 503},
+		{
+			name:     "RetryMethods",
+			opts:     []RetryOption{RetryMethods(http.MethodPost)},
+			method:   http.MethodPost,
+			body:     "data",
+			statuses: []int{503, 200},
+			attempts: 2,
+			status:   200,
+		},
+		{name: "body replayed", method: http.MethodPut, body: "data", statuses: []int{503, 200}, attempts: 2, status: 200},
+		{
+			name:     "RetryOn",
+			opts:     []RetryOption{RetryOn(func(status int, err error) bool { return status == 500 })},
+			method:   http.MethodGet,
+			statuses: []int{500, 200},
+			attempts: 2,
+			status:   200,
+		},
+		{name: "budget", opts: []RetryOption{WithRetryBudget(exhausted)}, method: http.MethodGet, statuses: []int{503}, attempts: 1, status: 503, denied: "budget"},
+		{name: "Retry-After honored", method: http.MethodGet, statuses: []int{503, 200}, retryAfter: "0", attempts: 2, status: 200},
+		{
+			name:       "Retry-After too long",
+			method:     http.MethodGet,
+			statuses:   []int{503},
+			retryAfter: "60",
+			attempts:   1,
+			status:     503,
+			denied:     "retry_after",
+		},
+		{
+			name:     "deadline",
+			opts:     []RetryOption{Backoff(time.Second, time.Second)},
+			method:   http.MethodGet,
+			statuses: []int{503},
+			timeout:  500 * time.Millisecond,
+			attempts: 1,
+			status:   503,
+			denied:   "deadline",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mutex  sync.Mutex
+				bodies []string
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+
+				mutex.Lock()
+				status := tt.statuses[len(bodies)]
+				bodies = append(bodies, string(body))
+				mutex.Unlock()
+
+				if status != http.StatusOK && len(tt.retryAfter) > 0 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			mc, err := metrics.New(metrics.Registry(prometheus.NewRegistry()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := append([]RetryOption{Backoff(time.Millisecond, 10*time.Millisecond), Jitter(0), RetryMetrics(mc)}, tt.opts...)
+			policy, err := NewRetryPolicy(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := NewClient("TestRetryPolicy " + tt.name)
+			c.Retry = policy
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			r, err := http.NewRequest(tt.method, srv.URL, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response, err := c.Do(r.WithContext(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+
+			if response.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", response.StatusCode, tt.status)
+			}
+			if len(bodies) != tt.attempts {
+				t.Errorf("%d attempts, want %d", len(bodies), tt.attempts)
+			}
+			for i, body := range bodies {
+				if body != tt.body {
+					t.Errorf("attempt %d sent %q, want %q", i+1, body, tt.body)
+				}
+			}
+
+			circuit := c.HystrixCommandName
+			if got := testutil.ToFloat64(policy.retries.With(prometheus.Labels{"circuit": circuit})); got != float64(tt.attempts-1) {
+				t.Errorf("hystrix_client_retries_total = %v, want %d", got, tt.attempts-1)
+			}
+			for _, reason := range []string{"attempts", "budget", "deadline", "retry_after"} {
+				want := 0.0
+				if reason == tt.denied {
+					want = 1
+				}
+				if got := testutil.ToFloat64(policy.denied.With(prometheus.Labels{"circuit": circuit, "reason": reason})); got != want {
+					t.Errorf("hystrix_client_retries_denied_total{reason=%q} = %v, want %v", reason, got, want)
+				}
+			}
+			result := strconv.Itoa(tt.status/100) + "xx"
+			if got := testutil.ToFloat64(policy.attempts.With(prometheus.Labels{"circuit": circuit, "result": result})); got < 1 {
+				t.Errorf("hystrix_client_attempts_total{result=%q} = %v, want at least 1", result, got)
+			}
+		})
+	}
+}
+
+func TestRetryAttemptSpans(t *testing.T) {
+	// the request's tracer, rather than the global one, traces attempts
+	global := mocktracer.New()
+	before := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(global)
+	defer opentracing.SetGlobalTracer(before)
+
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	mc, err := metrics.New(metrics.Registry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewRetryPolicy(Backoff(time.Millisecond, time.Millisecond), Jitter(0), RetryMetrics(mc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient("TestRetryAttemptSpans")
+	c.Retry = policy
+
+	tracer := mocktracer.New()
+	parent := tracer.StartSpan("parent")
+	r, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.Do(r.WithContext(opentracing.ContextWithSpan(context.Background(), parent)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	parent.Finish()
+
+	tests := []struct {
+		name   string
+		tracer *mocktracer.MockTracer
+		spans  int
+	}{
+		{name: "request's tracer", tracer: tracer, spans: 3}, // the parent & two attempts
+		{name: "global tracer", tracer: global},
+	}
+
+	for _, tt := range tests {
+		spans := tt.tracer.FinishedSpans()
+		if len(spans) != tt.spans {
+			t.Errorf("%s: %d spans, want %d", tt.name, len(spans), tt.spans)
+			continue
+		}
+		for i, span := range spans {
+			if span.OperationName == "parent" {
+				continue
+			}
+			if span.ParentID != parent.(*mocktracer.MockSpan).SpanContext.SpanID {
+				t.Errorf("%s: span %d is not a child of the request's span", tt.name, i)
+			}
+			if span.Tag("attempt") != i+1 {
+				t.Errorf("%s: span %d attempt = %v, want %d", tt.name, i, span.Tag("attempt"), i+1)
+			}
+		}
+	}
+}
+
+func TestNewRetryPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  RetryOption
+	}{
+		{name: "MaxAttempts", opt: MaxAttempts(0)},
+		{name: "Backoff, zero", opt: Backoff(0, time.Second)},
+		{name: "Backoff, max below initial", opt: Backoff(time.Second, time.Millisecond)},
+		{name: "Jitter", opt: Jitter(1.5)},
+		{name: "RetryOn", opt: RetryOn(nil)},
+		{name: "WithRetryBudget", opt: WithRetryBudget(nil)},
+		{name: "RetryMetrics", opt: RetryMetrics(nil)},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewRetryPolicy(tt.opt); err == nil {
+			t.Errorf("%s: NewRetryPolicy succeeded, want an error", tt.name)
+		}
+	}
+}
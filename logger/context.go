@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mchudgins/go-service-helper/correlationID"
+	"github.com/mchudgins/go-service-helper/route"
+	"github.com/mchudgins/go-service-helper/user"
+	"github.com/opentracing/opentracing-go"
+)
+
+type key struct{}
+
+// carrier keys which hold the trace & span IDs, by tracer
+var (
+	traceIDKeys = []string{"x-b3-traceid", "ot-tracer-traceid"}
+	spanIDKeys  = []string{"x-b3-spanid", "ot-tracer-spanid"}
+)
+
+// NewContext returns a copy of ctx carrying the request scoped logger.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, key{}, l)
+}
+
+// FromContext returns the request scoped logger, or Default() if there
+// is none, with the request's correlation ID, trace & span IDs, user ID,
+// verified client certificate identity and route added.  Values are read
+// when FromContext is called, so those set further down the handler chain
+// (e.g. the span) are included.
+func FromContext(ctx context.Context) Logger {
+	l, ok := ctx.Value(key{}).(Logger)
+	if !ok {
+		l = Default()
+	}
+
+	fields := make([]Field, 0, 6)
+	if corrID := correlationID.FromContext(ctx); len(corrID) > 0 {
+		fields = append(fields, String(CorrelationIDKey, corrID))
+	}
+	if traceID, spanID := spanIDs(ctx); len(traceID) > 0 {
+		fields = append(fields, String(TraceIDKey, traceID), String(SpanIDKey, spanID))
+	}
+	if uid := user.FromContext(ctx); len(uid) > 0 {
+		fields = append(fields, String(UserIDKey, uid))
+	}
+	if p := user.PeerFromContext(ctx); p != nil {
+		fields = append(fields, String(PeerKey, peerName(p)))
+	}
+	if name := route.FromContext(ctx); len(name) > 0 {
+		fields = append(fields, String(RouteKey, name))
+	}
+
+	if len(fields) == 0 {
+		return l
+	}
+	return l.With(fields...)
+}
+
+// peerName identifies the client by its SPIFFE ID, if it has one,
+// otherwise by its certificate's subject
+func peerName(p *user.Peer) string {
+	if len(p.SPIFFEID) > 0 {
+		return p.SPIFFEID
+	}
+	return p.Subject
+}
+
+// spanIDs returns the IDs of the active span, obtained by injecting its
+// context into a text map; OpenTracing has no tracer neutral accessor
+func spanIDs(ctx context.Context) (string, string) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", ""
+	}
+
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		return "", ""
+	}
+
+	return lookup(carrier, traceIDKeys), lookup(carrier, spanIDKeys)
+}
+
+func lookup(carrier opentracing.TextMapCarrier, keys []string) string {
+	for k, v := range carrier {
+		for _, want := range keys {
+			if strings.EqualFold(k, want) {
+				return v
+			}
+		}
+	}
+	return ""
+}
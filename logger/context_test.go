@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mchudgins/go-service-helper/correlationID"
+	"github.com/mchudgins/go-service-helper/route"
+	"github.com/mchudgins/go-service-helper/user"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// fieldsLogger remembers the fields added by With
+type fieldsLogger struct {
+	fields []Field
+}
+
+func (l *fieldsLogger) Debug(string, ...Field) {}
+func (l *fieldsLogger) Info(string, ...Field)  {}
+func (l *fieldsLogger) Warn(string, ...Field)  {}
+func (l *fieldsLogger) Error(string, ...Field) {}
+func (l *fieldsLogger) Sync() error            { return nil }
+func (l *fieldsLogger) With(fields ...Field) Logger {
+	return &fieldsLogger{fields: append(append([]Field{}, l.fields...), fields...)}
+}
+
+// b3Injector injects a mock span's IDs as zipkin's tracer does
+type b3Injector struct{}
+
+func (b3Injector) Inject(sc mocktracer.MockSpanContext, carrier interface{}) error {
+	w := carrier.(opentracing.TextMapWriter)
+	w.Set("X-B3-TraceId", fmt.Sprintf("%016x", sc.TraceID))
+	w.Set("X-B3-SpanId", fmt.Sprintf("%016x", sc.SpanID))
+	return nil
+}
+
+func TestFromContext(t *testing.T) {
+	tracer := mocktracer.New()
+	tracer.RegisterInjector(opentracing.TextMap, b3Injector{})
+	span := tracer.StartSpan("test")
+	sc := span.Context().(mocktracer.MockSpanContext)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want map[string]interface{}
+	}{
+		{name: "empty", ctx: context.Background(), want: map[string]interface{}{}},
+		{
+			name: "correlation ID & route",
+			ctx:  route.NewContext(correlationID.NewContext(context.Background(), "abc"), "/things"),
+			want: map[string]interface{}{CorrelationIDKey: "abc", RouteKey: "/things"},
+		},
+		{
+			name: "span",
+			ctx:  opentracing.ContextWithSpan(context.Background(), span),
+			want: map[string]interface{}{
+				TraceIDKey: fmt.Sprintf("%016x", sc.TraceID),
+				SpanIDKey:  fmt.Sprintf("%016x", sc.SpanID),
+			},
+		},
+		{
+			name: "user & SPIFFE peer",
+			ctx: user.NewPeerContext(user.NewContext(context.Background(), "alice"),
+				&user.Peer{Subject: "CN=client", SPIFFEID: "spiffe://example.org/client"}),
+			want: map[string]interface{}{UserIDKey: "alice", PeerKey: "spiffe://example.org/client"},
+		},
+		{
+			name: "peer",
+			ctx:  user.NewPeerContext(context.Background(), &user.Peer{Subject: "CN=client"}),
+			want: map[string]interface{}{PeerKey: "CN=client"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContext(tt.ctx, &fieldsLogger{})
+
+			got := make(map[string]interface{})
+			for _, f := range FromContext(ctx).(*fieldsLogger).fields {
+				got[f.Key] = f.Value
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("fields = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Package logger is the structured logging abstraction shared by the
+// go-service-helper packages.  Adapters are provided for zap, logrus
+// and (with Go 1.21 or later) log/slog, so that an application & its
+// middleware emit a single, consistent log stream.
+package logger
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// well known field names, shared by all the packages
+const (
+	ServiceKey       = "service"
+	CorrelationIDKey = "correlationID"
+	TraceIDKey       = "traceID"
+	SpanIDKey        = "spanID"
+	UserIDKey        = "userID"
+	PeerKey          = "peer"
+	RouteKey         = "route"
+	ErrorKey         = "error"
+)
+
+// Field is a key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is implemented by each of the adapters.  With returns a child
+// logger which adds the fields to every entry.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	With(fields ...Field) Logger
+	Sync() error
+}
+
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err returns an "error" field; a nil error is logged as such.
+func Err(err error) Field {
+	return Field{Key: ErrorKey, Value: err}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Stack returns a field holding the calling goroutine's stack trace.
+func Stack(key string) Field {
+	return Field{Key: key, Value: string(debug.Stack())}
+}
+
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value}
+}
+
+var (
+	mutex         sync.RWMutex
+	defaultLogger = NewLogrus(logrus.StandardLogger())
+)
+
+// Default returns the process wide logger, used by packages which are
+// not otherwise given one.  Unless replaced with SetDefault, it writes
+// to the standard logrus logger.
+func Default() Logger {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return defaultLogger
+}
+
+// SetDefault replaces the process wide logger; a server started with
+// server.WithProcessDefaults does so with its logger.
+func SetDefault(l Logger) {
+	if l == nil {
+		return
+	}
+
+	mutex.Lock()
+	defaultLogger = l
+	mutex.Unlock()
+}
+
+// NewNop returns a Logger which discards everything.
+func NewNop() Logger {
+	return nop{}
+}
+
+type nop struct{}
+
+func (nop) Debug(string, ...Field) {}
+func (nop) Info(string, ...Field)  {}
+func (nop) Warn(string, ...Field)  {}
+func (nop) Error(string, ...Field) {}
+func (n nop) With(...Field) Logger { return n }
+func (nop) Sync() error            { return nil }
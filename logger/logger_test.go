@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// adapter constructs a Logger which writes JSON to w
+type adapter struct {
+	name string
+	new  func(w io.Writer) Logger
+}
+
+var adapters = []adapter{
+	{
+		name: "logrus",
+		new: func(w io.Writer) Logger {
+			l := logrus.New()
+			l.Out = w
+			l.Formatter = &logrus.JSONFormatter{}
+			l.Level = logrus.InfoLevel
+			return NewLogrus(l)
+		},
+	},
+	{
+		name: "zap",
+		new: func(w io.Writer) Logger {
+			encoder := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg", LevelKey: "level"})
+			return NewZap(zap.New(zapcore.NewCore(encoder, zapcore.AddSync(w), zap.InfoLevel)))
+		},
+	},
+}
+
+func TestAdapters(t *testing.T) {
+	tests := []struct {
+		name   string
+		log    func(l Logger)
+		lines  int
+		fields map[string]interface{} // of the last line
+	}{
+		{
+			name:   "fields",
+			log:    func(l Logger) { l.Info("hello", String("a", "1"), Bool("b", true)) },
+			lines:  1,
+			fields: map[string]interface{}{"msg": "hello", "a": "1", "b": true},
+		},
+		{
+			name:   "With",
+			log:    func(l Logger) { l.With(String(ServiceKey, "svc")).Warn("hello", String("a", "1")) },
+			lines:  1,
+			fields: map[string]interface{}{"msg": "hello", ServiceKey: "svc", "a": "1"},
+		},
+		{
+			name: "With leaves the parent",
+			log: func(l Logger) {
+				l.With(String(ServiceKey, "svc"))
+				l.Error("hello")
+			},
+			lines:  1,
+			fields: map[string]interface{}{"msg": "hello", ServiceKey: nil},
+		},
+		{
+			name:  "below the level",
+			log:   func(l Logger) { l.Debug("hello") },
+			lines: 0,
+		},
+	}
+
+	for _, adapter := range adapters {
+		for _, tt := range tests {
+			t.Run(adapter.name+"/"+tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				l := adapter.new(&buf)
+				tt.log(l)
+				if err := l.Sync(); err != nil {
+					t.Errorf("Sync() = %v", err)
+				}
+
+				lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+				if buf.Len() == 0 {
+					lines = nil
+				}
+				if len(lines) != tt.lines {
+					t.Fatalf("logged %q, want %d lines", buf.String(), tt.lines)
+				}
+				if len(lines) == 0 {
+					return
+				}
+
+				var got map[string]interface{}
+				if err := json.Unmarshal(lines[len(lines)-1], &got); err != nil {
+					t.Fatal(err)
+				}
+				for k, v := range tt.fields {
+					if got[k] != v {
+						t.Errorf("%s = %v, want %v", k, got[k], v)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	before := Default()
+	defer SetDefault(before)
+
+	nop := NewNop()
+	tests := []struct {
+		name string
+		set  Logger
+		want Logger
+	}{
+		{name: "replaced", set: nop, want: nop},
+		{name: "nil is ignored", set: nil, want: nop},
+	}
+
+	for _, tt := range tests {
+		SetDefault(tt.set)
+		if got := Default(); got != tt.want {
+			t.Errorf("%s: Default() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+type logrusLogger struct {
+	entry *logrus.Entry
+}
+
+// NewLogrus adapts a logrus logger (or entry).
+func NewLogrus(l logrus.FieldLogger) Logger {
+	if l == nil {
+		l = logrus.StandardLogger()
+	}
+	return &logrusLogger{entry: l.WithFields(logrus.Fields{})}
+}
+
+func (l *logrusLogger) with(fields []Field) *logrus.Entry {
+	if len(fields) == 0 {
+		return l.entry
+	}
+
+	lf := make(logrus.Fields, len(fields))
+	for _, f := range fields {
+		lf[f.Key] = f.Value
+	}
+	return l.entry.WithFields(lf)
+}
+
+func (l *logrusLogger) Debug(msg string, fields ...Field) {
+	l.with(fields).Debug(msg)
+}
+
+func (l *logrusLogger) Info(msg string, fields ...Field) {
+	l.with(fields).Info(msg)
+}
+
+func (l *logrusLogger) Warn(msg string, fields ...Field) {
+	l.with(fields).Warn(msg)
+}
+
+func (l *logrusLogger) Error(msg string, fields ...Field) {
+	l.with(fields).Error(msg)
+}
+
+func (l *logrusLogger) With(fields ...Field) Logger {
+	return &logrusLogger{entry: l.with(fields)}
+}
+
+// Sync is a no-op; logrus does not buffer
+func (l *logrusLogger) Sync() error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build go1.21
+// +build go1.21
+
+package logger
+
+import (
+	"io"
+	"log/slog"
+)
+
+func init() {
+	adapters = append(adapters, adapter{
+		name: "slog",
+		new: func(w io.Writer) Logger {
+			return NewSlog(slog.New(slog.NewJSONHandler(w, nil)))
+		},
+	})
+}
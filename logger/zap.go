@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"go.uber.org/zap"
+)
+
+type zapLogger struct {
+	l *zap.Logger
+}
+
+// NewZap adapts a zap logger.
+func NewZap(l *zap.Logger) Logger {
+	if l == nil {
+		l = zap.NewNop()
+	}
+	// skip the adapter when reporting the caller
+	return &zapLogger{l: l.WithOptions(zap.AddCallerSkip(1))}
+}
+
+func zapFields(fields []Field) []zap.Field {
+	zf := make([]zap.Field, len(fields))
+	for i, f := range fields {
+		zf[i] = zap.Any(f.Key, f.Value)
+	}
+	return zf
+}
+
+func (z *zapLogger) Debug(msg string, fields ...Field) {
+	z.l.Debug(msg, zapFields(fields)...)
+}
+
+func (z *zapLogger) Info(msg string, fields ...Field) {
+	z.l.Info(msg, zapFields(fields)...)
+}
+
+func (z *zapLogger) Warn(msg string, fields ...Field) {
+	z.l.Warn(msg, zapFields(fields)...)
+}
+
+func (z *zapLogger) Error(msg string, fields ...Field) {
+	z.l.Error(msg, zapFields(fields)...)
+}
+
+func (z *zapLogger) With(fields ...Field) Logger {
+	return &zapLogger{l: z.l.With(zapFields(fields)...)}
+}
+
+func (z *zapLogger) Sync() error {
+	return z.l.Sync()
+}
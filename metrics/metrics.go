@@ -0,0 +1,198 @@
+// Package metrics configures where, and with what names, the Prometheus
+// metrics of this module's packages are registered.  Nothing is
+// registered when a package is imported; each component registers its
+// metrics, per a Config, when it is constructed.
+//
+// example:
+//
+//	registry := prometheus.NewRegistry()
+//	cfg, _ := metrics.New(metrics.Registry(registry), metrics.Namespace("orders"))
+//	mw, _ := handlers.NewHTTPMetrics(handlers.WithMetrics(cfg))
+//	http.Handle("/metrics", cfg.Handler())
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Config is the registry, and the name prefix & labels, for metrics.
+type Config struct {
+	Registerer  prometheus.Registerer
+	Gatherer    prometheus.Gatherer // serves the registered metrics, see Handler
+	Namespace   string
+	Subsystem   string
+	ConstLabels prometheus.Labels // added to every metric, e.g. the service name
+}
+
+type Option func(*Config) error
+
+var defaultConfig = &Config{
+	Registerer: prometheus.DefaultRegisterer,
+	Gatherer:   prometheus.DefaultGatherer,
+}
+
+// Default registers metrics with prometheus.DefaultRegisterer, without
+// a namespace, subsystem or constant labels.
+func Default() *Config {
+	return defaultConfig
+}
+
+// New returns a Config which, by default, is the same as Default().
+func New(opts ...Option) (*Config, error) {
+	cfg := &Config{
+		Registerer: prometheus.DefaultRegisterer,
+		Gatherer:   prometheus.DefaultGatherer,
+	}
+
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// Registry registers with, and gathers from, r.
+func Registry(r *prometheus.Registry) Option {
+	return func(cfg *Config) error {
+		if r == nil {
+			return fmt.Errorf("metrics.Registry requires a non-nil *prometheus.Registry")
+		}
+		cfg.Registerer = r
+		cfg.Gatherer = r
+		return nil
+	}
+}
+
+// Registerer registers with r; also gathering from it, if r is a
+// prometheus.Gatherer.
+func Registerer(r prometheus.Registerer) Option {
+	return func(cfg *Config) error {
+		if r == nil {
+			return fmt.Errorf("metrics.Registerer requires a non-nil prometheus.Registerer")
+		}
+		cfg.Registerer = r
+		if g, ok := r.(prometheus.Gatherer); ok {
+			cfg.Gatherer = g
+		}
+		return nil
+	}
+}
+
+// Gatherer sets where Handler gathers metrics from.
+func Gatherer(g prometheus.Gatherer) Option {
+	return func(cfg *Config) error {
+		if g == nil {
+			return fmt.Errorf("metrics.Gatherer requires a non-nil prometheus.Gatherer")
+		}
+		cfg.Gatherer = g
+		return nil
+	}
+}
+
+func Namespace(namespace string) Option {
+	return func(cfg *Config) error {
+		cfg.Namespace = namespace
+		return nil
+	}
+}
+
+func Subsystem(subsystem string) Option {
+	return func(cfg *Config) error {
+		cfg.Subsystem = subsystem
+		return nil
+	}
+}
+
+// ConstLabels adds the labels to every metric.
+func ConstLabels(labels prometheus.Labels) Option {
+	return func(cfg *Config) error {
+		if cfg.ConstLabels == nil {
+			cfg.ConstLabels = make(prometheus.Labels, len(labels))
+		}
+		for name, value := range labels {
+			cfg.ConstLabels[name] = value
+		}
+		return nil
+	}
+}
+
+// constLabels returns a copy, so that collectors do not share the map
+func (cfg *Config) constLabels() prometheus.Labels {
+	if len(cfg.ConstLabels) == 0 {
+		return nil
+	}
+
+	labels := make(prometheus.Labels, len(cfg.ConstLabels))
+	for name, value := range cfg.ConstLabels {
+		labels[name] = value
+	}
+	return labels
+}
+
+func (cfg *Config) CounterOpts(name, help string) prometheus.CounterOpts {
+	return prometheus.CounterOpts{
+		Namespace:   cfg.Namespace,
+		Subsystem:   cfg.Subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: cfg.constLabels(),
+	}
+}
+
+func (cfg *Config) GaugeOpts(name, help string) prometheus.GaugeOpts {
+	return prometheus.GaugeOpts{
+		Namespace:   cfg.Namespace,
+		Subsystem:   cfg.Subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: cfg.constLabels(),
+	}
+}
+
+func (cfg *Config) HistogramOpts(name, help string, buckets []float64) prometheus.HistogramOpts {
+	return prometheus.HistogramOpts{
+		Namespace:   cfg.Namespace,
+		Subsystem:   cfg.Subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: cfg.constLabels(),
+		Buckets:     buckets,
+	}
+}
+
+func (cfg *Config) SummaryOpts(name, help string) prometheus.SummaryOpts {
+	return prometheus.SummaryOpts{
+		Namespace:   cfg.Namespace,
+		Subsystem:   cfg.Subsystem,
+		Name:        name,
+		Help:        help,
+		ConstLabels: cfg.constLabels(),
+	}
+}
+
+// Register registers c, returning it or, if an identical collector was
+// registered earlier (e.g. by a second instance of the same component),
+// that one.
+func (cfg *Config) Register(c prometheus.Collector) (prometheus.Collector, error) {
+	if err := cfg.Registerer.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// Handler serves the metrics gathered by the Config.
+func (cfg *Config) Handler() http.Handler {
+	if cfg.Gatherer == prometheus.DefaultGatherer {
+		return promhttp.Handler()
+	}
+	return promhttp.HandlerFor(cfg.Gatherer, promhttp.HandlerOpts{})
+}
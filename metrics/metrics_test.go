@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string // the exposed sample
+	}{
+		{name: "plain", want: "requests_total 1"},
+		{name: "namespace", opts: []Option{Namespace("orders")}, want: "orders_requests_total 1"},
+		{
+			name: "namespace & subsystem",
+			opts: []Option{Namespace("orders"), Subsystem("http")},
+			want: "orders_http_requests_total 1",
+		},
+		{
+			name: "constant labels",
+			opts: []Option{ConstLabels(prometheus.Labels{"service": "orders"}), ConstLabels(prometheus.Labels{"zone": "a"})},
+			want: `requests_total{service="orders",zone="a"} 1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := New(append([]Option{Registry(prometheus.NewRegistry())}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := cfg.Register(prometheus.NewCounter(cfg.CounterOpts("requests_total", "Requests.")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.(prometheus.Counter).Inc()
+
+			w := httptest.NewRecorder()
+			cfg.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			if !strings.Contains(w.Body.String(), "\n"+tt.want+"\n") {
+				t.Errorf("exposed\n%s\nwant %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	cfg, err := New(Registry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := cfg.Register(prometheus.NewCounter(cfg.CounterOpts("requests_total", "Requests.")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		collector prometheus.Collector
+		existing  bool // the first collector is returned
+		err       bool
+	}{
+		{name: "identical", collector: prometheus.NewCounter(cfg.CounterOpts("requests_total", "Requests.")), existing: true},
+		{name: "conflicting", collector: prometheus.NewGauge(cfg.GaugeOpts("requests_total", "Other.")), err: true},
+		{name: "different", collector: prometheus.NewCounter(cfg.CounterOpts("errors_total", "Errors."))},
+	}
+
+	for _, tt := range tests {
+		c, err := cfg.Register(tt.collector)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: Register() = %v, want an error: %t", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && (c == first) != tt.existing {
+			t.Errorf("%s: returned the existing collector = %t, want %t", tt.name, c == first, tt.existing)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{name: "Registry", opt: Registry(nil)},
+		{name: "Registerer", opt: Registerer(nil)},
+		{name: "Gatherer", opt: Gatherer(nil)},
+	}
+
+	for _, tt := range tests {
+		if _, err := New(tt.opt); err == nil {
+			t.Errorf("New(%s(nil)) succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestConstLabelsCopied(t *testing.T) {
+	labels := prometheus.Labels{"service": "orders"}
+	cfg, err := New(ConstLabels(labels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels["service"] = "changed"
+
+	opts := cfg.CounterOpts("requests_total", "Requests.")
+	if opts.ConstLabels["service"] != "orders" {
+		t.Errorf("service = %q, want orders", opts.ConstLabels["service"])
+	}
+	opts.ConstLabels["service"] = "changed"
+	if cfg.ConstLabels["service"] != "orders" {
+		t.Errorf("the collector's labels are shared with the Config")
+	}
+}
@@ -0,0 +1,99 @@
+// Package route records the name of the route (e.g. the gorilla mux path
+// template or the gRPC method) serving a request, so that middleware
+// which runs before the router, such as loggers, can report it.
+package route
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+type key struct{}
+
+// holder is mutable so that a route matched further down the handler
+// chain is visible to middleware holding an earlier context
+type holder struct {
+	mutex sync.RWMutex
+	name  string
+}
+
+// NewContext returns a copy of ctx able to record a route, initially name.
+func NewContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, key{}, &holder{name: name})
+}
+
+// Set records the route serving the request.  It reports false if the
+// context was not created by NewContext.
+func Set(ctx context.Context, name string) bool {
+	h, ok := ctx.Value(key{}).(*holder)
+	if !ok {
+		return false
+	}
+
+	h.mutex.Lock()
+	h.name = name
+	h.mutex.Unlock()
+
+	return true
+}
+
+// FromContext returns the route recorded for the request, if any.
+func FromContext(ctx context.Context) string {
+	h, ok := ctx.Value(key{}).(*holder)
+	if !ok {
+		return ""
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.name
+}
+
+// Handler is HTTP middleware which makes the request able to record its route.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := req.Context().Value(key{}).(*holder); !ok {
+			req = req.WithContext(NewContext(req.Context(), ""))
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// MuxMiddleware records the route matched by a gorilla mux Router; its
+// name if it has one, otherwise its path template.  Install it with
+// Router.Use.
+func MuxMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r := mux.CurrentRoute(req); r != nil {
+			Set(req.Context(), muxRouteName(r))
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// MuxHandler is MuxMiddleware for a Router which cannot be modified: it
+// matches the request itself before passing it to router.
+func MuxHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var match mux.RouteMatch
+		if router.Match(req, &match) && match.MatchErr == nil && match.Route != nil {
+			Set(req.Context(), muxRouteName(match.Route))
+		}
+
+		router.ServeHTTP(w, req)
+	})
+}
+
+func muxRouteName(r *mux.Route) string {
+	name := r.GetName()
+	if len(name) == 0 {
+		name, _ = r.GetPathTemplate()
+	}
+	return name
+}
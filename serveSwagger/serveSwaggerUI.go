@@ -3,7 +3,7 @@ package serveSwagger
 import (
 	"net/http"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/mchudgins/go-service-helper/logger"
 )
 
 // This package serves up the Swagger UI at the designated path
@@ -34,11 +34,11 @@ func NewSwaggerProxy(proxyPath string) (*SwaggerProxy, error) {
 // ServeHTTP serves up the Swagger UI
 func (s *SwaggerProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	log.WithField("path", r.URL.Path).WithField("proxyPath", s.path).Debug("ServeHTTP")
+	logger.Default().Debug("ServeHTTP", logger.String("path", r.URL.Path), logger.String("proxyPath", s.path))
 
 	if r.URL.Path == s.path {
 		r.URL.Path = s.path + "/index.html"
-		log.WithField("newPath", r.URL.Path).Debug("revising path")
+		logger.Default().Debug("revising path", logger.String("newPath", r.URL.Path))
 	}
 
 	s.h.ServeHTTP(w, r)
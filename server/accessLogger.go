@@ -1,40 +1,95 @@
 package server
 
 import (
-	"go.uber.org/zap"
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/route"
+	"github.com/mwitkow/go-grpc-middleware"
 	xcontext "golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
-func grpcEndpointLog(logger *zap.Logger, s string) grpc.UnaryServerInterceptor {
+// metadataFields returns the metadata, filtered by the header policy, as
+// log fields
+func metadataFields(md metadata.MD, filter func(map[string][]string) map[string]interface{}) []logger.Field {
+	values := filter(md)
+	fields := make([]logger.Field, 0, len(values))
+	for key, value := range values {
+		fields = append(fields, logger.Any(key, value))
+	}
+	return fields
+}
+
+func grpcEndpointLog(log logger.Logger, s string, filter func(map[string][]string) map[string]interface{}) grpc.UnaryServerInterceptor {
 	return func(ctx xcontext.Context,
 		req interface{},
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler) (interface{}, error) {
-		logger.Info("grpcEndpointLog+",
-			zap.String("endpoint", s),
-			zap.String("method", info.FullMethod))
+		log.Info("grpcEndpointLog+",
+			logger.String("endpoint", s),
+			logger.String("method", info.FullMethod))
 		md, ok := metadata.FromIncomingContext(ctx)
 		if ok {
-			for key, value := range md {
-				logger.Info("metadata", zap.String(key, value[0]))
-			}
+			log.Info("metadata", metadataFields(md, filter)...)
 		}
 		defer func() {
-			logger.Info("grpcEndpointLog-", zap.String("", s))
-			logger.Sync()
+			log.Info("grpcEndpointLog-", logger.String("endpoint", s))
+			log.Sync()
 		}()
 
 		rc, err := handler(ctx, req)
 
 		md, ok = metadata.FromOutgoingContext(ctx)
 		if ok {
-			for key, value := range md {
-				logger.Info("outgoing metadata", zap.String(key, value[0]))
-			}
+			log.Info("outgoing metadata", metadataFields(md, filter)...)
 		}
 
 		return rc, err
 	}
 }
+
+func grpcStreamEndpointLog(log logger.Logger, s string, filter func(map[string][]string) map[string]interface{}) grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		log.Info("grpcStreamEndpointLog+",
+			logger.String("endpoint", s),
+			logger.String("method", info.FullMethod),
+			logger.Bool("clientStream", info.IsClientStream),
+			logger.Bool("serverStream", info.IsServerStream))
+		md, ok := metadata.FromIncomingContext(stream.Context())
+		if ok {
+			log.Info("metadata", metadataFields(md, filter)...)
+		}
+		defer func() {
+			log.Info("grpcStreamEndpointLog-", logger.String("endpoint", s))
+			log.Sync()
+		}()
+
+		return handler(srv, stream)
+	}
+}
+
+// grpcRequestLogger makes the logger, tagged with the RPC's method (route),
+// available to handlers via logger.FromContext
+func grpcRequestLogger(log logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx xcontext.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = route.NewContext(logger.NewContext(ctx, log), info.FullMethod)
+		return handler(ctx, req)
+	}
+}
+
+func grpcStreamRequestLogger(log logger.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = route.NewContext(logger.NewContext(stream.Context(), log), info.FullMethod)
+		return handler(srv, wrapped)
+	}
+}
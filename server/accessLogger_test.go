@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	gsh "github.com/mchudgins/go-service-helper/handlers"
+	"github.com/mchudgins/go-service-helper/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// entry is a line logged by a capturingLogger
+type entry struct {
+	msg    string
+	fields map[string]interface{}
+}
+
+// capturingLogger remembers the lines logged at Info & above, with the
+// fields added by With
+type capturingLogger struct {
+	*captured
+	fields []logger.Field
+}
+
+type captured struct {
+	mutex   sync.Mutex
+	entries []entry
+}
+
+func newCapturingLogger() *capturingLogger {
+	return &capturingLogger{captured: &captured{}}
+}
+
+func (l *capturingLogger) log(msg string, fields []logger.Field) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e := entry{msg: msg, fields: make(map[string]interface{})}
+	for _, f := range append(append([]logger.Field{}, l.fields...), fields...) {
+		e.fields[f.Key] = f.Value
+	}
+	l.entries = append(l.entries, e)
+}
+
+func (l *capturingLogger) Debug(string, ...logger.Field)            {}
+func (l *capturingLogger) Info(msg string, fields ...logger.Field)  { l.log(msg, fields) }
+func (l *capturingLogger) Warn(msg string, fields ...logger.Field)  { l.log(msg, fields) }
+func (l *capturingLogger) Error(msg string, fields ...logger.Field) { l.log(msg, fields) }
+func (l *capturingLogger) Sync() error                              { return nil }
+func (l *capturingLogger) With(fields ...logger.Field) logger.Logger {
+	return &capturingLogger{captured: l.captured, fields: append(append([]logger.Field{}, l.fields...), fields...)}
+}
+
+func (l *capturingLogger) find(msg string) (entry, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, e := range l.entries {
+		if e.msg == msg {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+func TestGRPCEndpointLogRedactsMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy gsh.HeaderPolicy
+		md     metadata.MD
+		want   map[string]interface{}
+	}{
+		{
+			name:   "default policy",
+			policy: gsh.DefaultHeaderPolicy(),
+			md:     metadata.Pairs("authorization", "Bearer secret", "x-api-key", "secret", "user-agent", "test"),
+			want: map[string]interface{}{
+				"Authorization": gsh.Redacted,
+				"X-Api-Key":     gsh.Redacted,
+				"User-Agent":    "test",
+			},
+		},
+		{
+			name:   "allow list",
+			policy: gsh.HeaderPolicy{Allow: []string{"x-tenant"}},
+			md:     metadata.Pairs("x-tenant", "acme", "user-agent", "test"),
+			want:   map[string]interface{}{"X-Tenant": "acme"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newCapturingLogger()
+			interceptor := grpcEndpointLog(log, "svc", tt.policy.Filter())
+
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Method"},
+				func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e, ok := log.find("metadata")
+			if !ok {
+				t.Fatal("the metadata was not logged")
+			}
+			if len(e.fields) != len(tt.want) {
+				t.Errorf("logged %v, want %v", e.fields, tt.want)
+			}
+			for k, v := range tt.want {
+				if e.fields[k] != v {
+					t.Errorf("%s = %v, want %v", k, e.fields[k], v)
+				}
+			}
+
+			if e, ok := log.find("grpcEndpointLog-"); !ok || e.fields["endpoint"] != "svc" {
+				t.Errorf("grpcEndpointLog- = %v, want endpoint svc", e.fields)
+			}
+		})
+	}
+}
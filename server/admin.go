@@ -0,0 +1,52 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	afex "github.com/afex/hystrix-go/hystrix"
+	"github.com/mchudgins/go-service-helper/actuator"
+	"github.com/mchudgins/go-service-helper/hystrix"
+)
+
+/*
+	The admin endpoints for THIS instance, served on the metrics listener
+	(these are not expected to be proxied to end users)
+*/
+
+// instanceHandlers returns the endpoints which describe this instance,
+// keyed by path.  They may also be published on the public HTTP port.
+func (s *Server) instanceHandlers() map[string]http.Handler {
+	return map[string]http.Handler{
+		"/debug/vars": expvar.Handler(),
+		"/healthz":    s.cfg.health.LivenessHandler(),
+		"/metrics":    s.cfg.metrics.Handler(),
+		"/readyz":     s.cfg.health.ReadinessHandler(),
+	}
+}
+
+// newAdminServer constructs the admin server with an index at "/"
+func (s *Server) newAdminServer(endpoints map[string]http.Handler) {
+	adminMux := actuator.NewActuatorMux("/")
+
+	for pattern, handler := range endpoints {
+		adminMux.Handle(pattern, handler)
+	}
+
+	adminMux.HandleFunc("/debug/pprof/", pprof.Index)
+	adminMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	adminMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	adminMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	adminMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	s.hystrixStream = afex.NewStreamHandler()
+	s.hystrixStream.Start()
+	adminMux.Handle("/hystrix.stream", s.hystrixStream)
+	adminMux.Handle("/hystrix/config", hystrix.ConfigHandler())
+
+	s.metricsServer = &http.Server{
+		Addr:    s.metricsListener.Addr().String(),
+		Handler: adminMux,
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	tests := []struct {
+		path      string
+		published bool // also served on the HTTP port by WithPublicAdminEndpoints
+	}{
+		{path: "/debug/vars", published: true},
+		{path: "/healthz", published: true},
+		{path: "/metrics", published: true},
+		{path: "/readyz", published: true},
+		{path: "/debug/pprof/"},
+		{path: "/hystrix/config"},
+	}
+
+	for _, public := range []bool{false, true} {
+		s, err := New(testOptions(WithPublicAdminEndpoints(public))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range tests {
+			w := httptest.NewRecorder()
+			s.metricsServer.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("admin %s = %d, want %d", tt.path, w.Code, http.StatusOK)
+			}
+
+			want := http.StatusNotFound
+			if public && tt.published {
+				want = http.StatusOK
+			}
+			w = httptest.NewRecorder()
+			s.httpServer.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != want {
+				t.Errorf("public %s with WithPublicAdminEndpoints(%t) = %d, want %d", tt.path, public, w.Code, want)
+			}
+		}
+
+		s.Shutdown(context.Background())
+	}
+}
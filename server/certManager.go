@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*
+	Keep the server certificate current, reloading it when the
+	files change on disk (or when a SIGHUP is received)
+*/
+
+type certManager struct {
+	certFilename string
+	keyFilename  string
+	logger       logger.Logger
+	reloads      *prometheus.CounterVec
+	expiry       prometheus.Gauge
+	mutex        sync.RWMutex
+	cert         *tls.Certificate
+	certModTime  time.Time
+	keyModTime   time.Time
+	quit         chan struct{}
+	stopOnce     sync.Once
+}
+
+func newCertManager(certFilename, keyFilename string, log logger.Logger, mc *metrics.Config) (*certManager, error) {
+	m := &certManager{
+		certFilename: certFilename,
+		keyFilename:  keyFilename,
+		logger:       log,
+		quit:         make(chan struct{}),
+	}
+
+	c, err := mc.Register(prometheus.NewCounterVec(
+		mc.CounterOpts("tls_certificate_reloads_total", "Number of attempts to reload the server certificate."),
+		[]string{"result"},
+	))
+	if err != nil {
+		return nil, err
+	}
+	m.reloads = c.(*prometheus.CounterVec)
+
+	c, err = mc.Register(prometheus.NewGauge(
+		mc.GaugeOpts("tls_certificate_expiry_timestamp_seconds", "Expiration time of the server certificate in use, as a unix timestamp."),
+	))
+	if err != nil {
+		return nil, err
+	}
+	m.expiry = c.(prometheus.Gauge)
+
+	m.certModTime, m.keyModTime = m.modTimes()
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (m *certManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.cert, nil
+}
+
+// reload loads the certificate & key, swapping them in only if they
+// form a valid pair which is currently within its validity period
+func (m *certManager) reload() error {
+	cert, err := loadCertificate(m.certFilename, m.keyFilename)
+	if err != nil {
+		m.reloads.With(prometheus.Labels{"result": "failure"}).Inc()
+		return err
+	}
+
+	m.mutex.Lock()
+	m.cert = cert
+	m.mutex.Unlock()
+
+	m.reloads.With(prometheus.Labels{"result": "success"}).Inc()
+	m.expiry.Set(float64(cert.Leaf.NotAfter.Unix()))
+
+	m.logger.Info("server certificate loaded",
+		logger.String("certificate", m.certFilename),
+		logger.String("subject", cert.Leaf.Subject.String()),
+		logger.Time("notAfter", cert.Leaf.NotAfter))
+
+	return nil
+}
+
+func loadCertificate(certFilename, keyFilename string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFilename, keyFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf = leaf
+
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate %s is not valid until %s", certFilename, leaf.NotBefore)
+	}
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate %s expired at %s", certFilename, leaf.NotAfter)
+	}
+
+	return &cert, nil
+}
+
+func (m *certManager) modTimes() (certModTime, keyModTime time.Time) {
+	if fi, err := os.Stat(m.certFilename); err == nil {
+		certModTime = fi.ModTime()
+	}
+	if fi, err := os.Stat(m.keyFilename); err == nil {
+		keyModTime = fi.ModTime()
+	}
+
+	return certModTime, keyModTime
+}
+
+// watch reloads the certificate whenever either file changes (checked
+// every interval, if non-zero) or the process receives a SIGHUP
+func (m *certManager) watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tickc <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tickc = ticker.C
+	}
+
+	for {
+		select {
+		case <-m.quit:
+			return
+
+		case <-hup:
+			m.logger.Info("SIGHUP received, reloading server certificate")
+			if err := m.reload(); err != nil {
+				m.logger.Error("unable to reload server certificate; continuing with the current certificate", logger.Err(err))
+			}
+
+		case <-tickc:
+			certModTime, keyModTime := m.modTimes()
+			if certModTime.Equal(m.certModTime) && keyModTime.Equal(m.keyModTime) {
+				continue
+			}
+
+			// remember what we tried, so a half-written pair is
+			// retried once the other file is updated
+			m.certModTime, m.keyModTime = certModTime, keyModTime
+			if err := m.reload(); err != nil {
+				m.logger.Error("unable to reload server certificate; continuing with the current certificate", logger.Err(err))
+			}
+		}
+	}
+}
+
+func (m *certManager) stop() {
+	m.stopOnce.Do(func() { close(m.quit) })
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// writeCertificate writes a self-signed certificate & its key for the
+// host cn, valid from notBefore until notAfter
+func writeCertificate(t *testing.T, certFilename, keyFilename, cn string, notBefore, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFilename, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFilename, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func servedCN(t *testing.T, m *certManager) string {
+	cert, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestCertManagerReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	certFilename, keyFilename := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+
+	now := time.Now()
+	writeCertificate(t, certFilename, keyFilename, "initial", now.Add(-time.Hour), now.Add(time.Hour))
+
+	mc, err := metrics.New(metrics.Registry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newCertManager(certFilename, keyFilename, logger.NewNop(), mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := servedCN(t, m); cn != "initial" {
+		t.Fatalf("serving %s, want initial", cn)
+	}
+
+	// each step replaces the files, then reloads them
+	tests := []struct {
+		name      string
+		cn        string
+		notBefore time.Time
+		notAfter  time.Time
+		corrupt   bool // the key no longer matches the certificate
+		err       bool
+		serving   string
+	}{
+		{name: "renewed", cn: "renewed", notBefore: now.Add(-time.Minute), notAfter: now.Add(2 * time.Hour), serving: "renewed"},
+		{name: "expired", cn: "expired", notBefore: now.Add(-2 * time.Hour), notAfter: now.Add(-time.Hour), err: true, serving: "renewed"},
+		{name: "not yet valid", cn: "future", notBefore: now.Add(time.Hour), notAfter: now.Add(2 * time.Hour), err: true, serving: "renewed"},
+		{name: "mismatched key", cn: "mismatched", notBefore: now.Add(-time.Minute), notAfter: now.Add(time.Hour), corrupt: true, err: true, serving: "renewed"},
+		{name: "renewed again", cn: "again", notBefore: now.Add(-time.Minute), notAfter: now.Add(3 * time.Hour), serving: "again"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeCertificate(t, certFilename, keyFilename, tt.cn, tt.notBefore, tt.notAfter)
+			if tt.corrupt {
+				writeCertificate(t, filepath.Join(dir, "other.pem"), keyFilename, "other", tt.notBefore, tt.notAfter)
+			}
+
+			if err := m.reload(); (err != nil) != tt.err {
+				t.Errorf("reload() = %v, want an error: %t", err, tt.err)
+			}
+			if cn := servedCN(t, m); cn != tt.serving {
+				t.Errorf("serving %s, want %s", cn, tt.serving)
+			}
+		})
+	}
+
+	// the initial load is counted too
+	for result, want := range map[string]float64{"success": 3, "failure": 3} {
+		if got := testutil.ToFloat64(m.reloads.With(prometheus.Labels{"result": result})); got != want {
+			t.Errorf("tls_certificate_reloads_total{result=%q} = %v, want %v", result, got, want)
+		}
+	}
+}
+
+func TestCertManagerWatch(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	certFilename, keyFilename := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+
+	now := time.Now()
+	writeCertificate(t, certFilename, keyFilename, "initial", now.Add(-time.Hour), now.Add(time.Hour))
+
+	mc, err := metrics.New(metrics.Registry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newCertManager(certFilename, keyFilename, logger.NewNop(), mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.watch(5 * time.Millisecond)
+	defer m.stop()
+
+	writeCertificate(t, certFilename, keyFilename, "rotated", now.Add(-time.Hour), now.Add(time.Hour))
+	// file systems with coarse timestamps may not see the write as a change
+	later := now.Add(time.Minute)
+	for _, filename := range []string{certFilename, keyFilename} {
+		if err := os.Chtimes(filename, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedCN(t, m) != "rotated" {
+		if time.Now().After(deadline) {
+			t.Fatal("the rotated certificate was not loaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/mchudgins/go-service-helper/user"
+	"github.com/mwitkow/go-grpc-middleware"
+	xcontext "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+/*
+	Expose the identity from a verified client certificate (mTLS)
+	on the request context, see user.PeerFromContext
+*/
+
+func httpClientIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req, _ = user.PeerFromRequest(req)
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+func grpcPeerContext(ctx xcontext.Context) xcontext.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+
+	if id := user.PeerFromConnectionState(&tlsInfo.State); id != nil {
+		ctx = user.NewPeerContext(ctx, id)
+	}
+
+	return ctx
+}
+
+func grpcClientIdentity(ctx xcontext.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(grpcPeerContext(ctx), req)
+}
+
+func grpcStreamClientIdentity(srv interface{},
+	stream grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	wrapped := grpc_middleware.WrapServerStream(stream)
+	wrapped.WrappedContext = grpcPeerContext(stream.Context())
+
+	return handler(srv, wrapped)
+}
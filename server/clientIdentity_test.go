@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mchudgins/go-service-helper/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// issueCertificate returns a certificate for cn signed by parent, or a
+// self-signed CA certificate if parent is nil
+func issueCertificate(t *testing.T, parent *tls.Certificate, cn string, uris ...string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template.URIs = append(template.URIs, u)
+	}
+
+	issuer, signer := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestHTTPClientIdentity(t *testing.T) {
+	ca := issueCertificate(t, nil, "ca")
+	serverCert := issueCertificate(t, ca, "localhost")
+	client := issueCertificate(t, ca, "client", "spiffe://example.com/client")
+	stranger := issueCertificate(t, issueCertificate(t, nil, "other ca"), "stranger")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	tests := []struct {
+		name     string
+		mode     tls.ClientAuthType
+		cert     *tls.Certificate
+		rejected bool
+		identity string // SPIFFE ID seen by the handler
+	}{
+		{name: "required, no certificate", mode: tls.RequireAndVerifyClientCert, rejected: true},
+		{name: "required, untrusted certificate", mode: tls.RequireAndVerifyClientCert, cert: stranger, rejected: true},
+		{name: "required, trusted certificate", mode: tls.RequireAndVerifyClientCert, cert: client, identity: "spiffe://example.com/client"},
+		{name: "optional, no certificate", mode: tls.VerifyClientCertIfGiven},
+		{name: "optional, trusted certificate", mode: tls.VerifyClientCertIfGiven, cert: client, identity: "spiffe://example.com/client"},
+		{name: "requested, unverified certificate", mode: tls.RequestClientCert, cert: stranger},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(httpClientIdentity(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if p := user.PeerFromContext(req.Context()); p != nil {
+					io.WriteString(w, p.SPIFFEID)
+				}
+			})))
+			srv.TLS = &tls.Config{
+				Certificates: []tls.Certificate{*serverCert},
+				ClientAuth:   tt.mode,
+				ClientCAs:    pool,
+			}
+			srv.StartTLS()
+			defer srv.Close()
+
+			clientConfig := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+			if tt.cert != nil {
+				clientConfig.Certificates = []tls.Certificate{*tt.cert}
+			}
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+
+			resp, err := c.Get(srv.URL)
+			if tt.rejected {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("request succeeded, want the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.identity {
+				t.Errorf("identity = %q, want %q", body, tt.identity)
+			}
+		})
+	}
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s identityStream) Context() context.Context { return s.ctx }
+
+func TestGRPCClientIdentity(t *testing.T) {
+	ca := issueCertificate(t, nil, "ca")
+	client := issueCertificate(t, ca, "client")
+	verified := credentials.TLSInfo{State: tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{client.Leaf},
+		VerifiedChains:   [][]*x509.Certificate{{client.Leaf, ca.Leaf}},
+	}}
+	unverified := credentials.TLSInfo{State: tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{client.Leaf},
+	}}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		subject string // empty if no identity is expected
+	}{
+		{name: "no peer", ctx: context.Background()},
+		{name: "plaintext peer", ctx: peer.NewContext(context.Background(), &peer.Peer{})},
+		{name: "unverified certificate", ctx: peer.NewContext(context.Background(), &peer.Peer{AuthInfo: unverified})},
+		{name: "verified certificate", ctx: peer.NewContext(context.Background(), &peer.Peer{AuthInfo: verified}), subject: "CN=client"},
+	}
+
+	check := func(t *testing.T, ctx context.Context, subject string) {
+		p := user.PeerFromContext(ctx)
+		switch {
+		case len(subject) == 0 && p != nil:
+			t.Errorf("identity = %+v, want none", p)
+		case len(subject) != 0 && p == nil:
+			t.Error("no identity, want one")
+		case p != nil && p.Subject != subject:
+			t.Errorf("Subject = %q, want %q", p.Subject, subject)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := grpcClientIdentity(tt.ctx, nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					check(t, ctx, tt.subject)
+					return nil, nil
+				})
+			if err != nil {
+				t.Error(err)
+			}
+
+			err = grpcStreamClientIdentity(nil, identityStream{ctx: tt.ctx}, &grpc.StreamServerInfo{},
+				func(srv interface{}, stream grpc.ServerStream) error {
+					check(t, stream.Context(), tt.subject)
+					return nil
+				})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
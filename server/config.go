@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mchudgins/go-service-helper/accessLog"
+	"github.com/mchudgins/go-service-helper/correlationID"
+	"github.com/mchudgins/go-service-helper/health"
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/metrics"
+	"go.uber.org/zap"
+)
+
+// ConfigError collects every problem found while applying the Options
+// and validating the resulting Config.
+type ConfigError struct {
+	Errors []error
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return "invalid server configuration: " + strings.Join(msgs, "; ")
+}
+
+func (e *ConfigError) add(err error) {
+	if err != nil {
+		e.Errors = append(e.Errors, err)
+	}
+}
+
+// validate checks the Config for inconsistencies and fills in defaults
+// for anything which was omitted.
+func (cfg *Config) validate(cerr *ConfigError) {
+	if cfg.health == nil {
+		cfg.health = health.NewRegistry()
+	}
+
+	if cfg.correlationID == nil {
+		cfg.correlationID = correlationID.Default()
+	}
+
+	if cfg.accessLogOptions != nil {
+		al, err := accessLog.New(append([]accessLog.Option{accessLog.WithCorrelationID(cfg.correlationID)}, cfg.accessLogOptions...)...)
+		cerr.add(err)
+		cfg.accessLog = al
+	}
+
+	if cfg.metrics == nil {
+		cfg.metrics = metrics.Default()
+	}
+	if len(cfg.logSamplerOptions) > 0 {
+		sampler, err := accessLog.NewSampler(append([]accessLog.SamplerOption{accessLog.SamplerMetrics(cfg.metrics)}, cfg.logSamplerOptions...)...)
+		cerr.add(err)
+		cfg.logSampler = sampler
+	}
+
+	if cfg.logger == nil {
+		l, err := zap.NewProduction()
+		if err != nil {
+			l = zap.NewNop()
+		}
+		cfg.logger = logger.NewZap(l)
+	}
+	if len(cfg.serviceName) > 0 {
+		cfg.logger = cfg.logger.With(logger.String(logger.ServiceKey, cfg.serviceName))
+	}
+
+	// ports must be valid and must not collide
+	// (port 0 asks the kernel for an ephemeral port, so it may repeat)
+	ports := make(map[int]string)
+	checkPort := func(name string, port int) {
+		if port < 0 || port > 65535 {
+			cerr.add(fmt.Errorf("%s port %d is out of range", name, port))
+			return
+		}
+		if port == 0 {
+			return
+		}
+		if other, ok := ports[port]; ok {
+			cerr.add(fmt.Errorf("%s port %d is already in use by the %s listener", name, port, other))
+			return
+		}
+		ports[port] = name
+	}
+
+	if cfg.Handler != nil {
+		checkPort("HTTP", cfg.HTTPListenPort)
+	}
+	if cfg.RPCRegister != nil {
+		checkPort("RPC", cfg.RPCListenPort)
+	}
+	checkPort("metrics", cfg.MetricsListenPort)
+
+	// a certificate is useless without its key (and vice versa)
+	switch {
+	case len(cfg.CertFilename) > 0 && len(cfg.KeyFilename) == 0:
+		cerr.add(fmt.Errorf("certificate %s was provided without a key", cfg.CertFilename))
+	case len(cfg.CertFilename) == 0 && len(cfg.KeyFilename) > 0:
+		cerr.add(fmt.Errorf("key %s was provided without a certificate", cfg.KeyFilename))
+	case len(cfg.CertFilename) > 0:
+		if _, err := loadCertificate(cfg.CertFilename, cfg.KeyFilename); err != nil {
+			cerr.add(fmt.Errorf("unable to load certificate/key pair: %s", err))
+		}
+	case !cfg.Insecure && !hasCertificate(cfg.customTLSConfig):
+		cerr.add(fmt.Errorf("TLS requested, but no certificate was provided"))
+	}
+
+	if cfg.customTLSConfig == nil {
+		if _, err := tlsConfigFactory(cfg.TLSProfile); err != nil {
+			cerr.add(err)
+		}
+	}
+
+	if cfg.CertReloadPeriod < 0 {
+		cerr.add(fmt.Errorf("certificate reload period %s is negative", cfg.CertReloadPeriod))
+	}
+
+	if cfg.DrainDelay < 0 {
+		cerr.add(fmt.Errorf("drain delay %s is negative", cfg.DrainDelay))
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cerr.add(fmt.Errorf("shutdown timeout %s must be positive", cfg.ShutdownTimeout))
+	}
+
+	// client certificates can only be verified against a CA bundle
+	if len(cfg.ClientCAFilename) > 0 {
+		if cfg.Insecure {
+			cerr.add(fmt.Errorf("client CA %s requires a server certificate", cfg.ClientCAFilename))
+		}
+
+		pem, err := ioutil.ReadFile(cfg.ClientCAFilename)
+		if err != nil {
+			cerr.add(fmt.Errorf("unable to read client CA bundle: %s", err))
+		} else {
+			cfg.clientCAs = x509.NewCertPool()
+			if !cfg.clientCAs.AppendCertsFromPEM(pem) {
+				cerr.add(fmt.Errorf("no certificates found in client CA bundle %s", cfg.ClientCAFilename))
+			}
+		}
+	} else if (cfg.ClientAuth == tls.VerifyClientCertIfGiven || cfg.ClientAuth == tls.RequireAndVerifyClientCert) &&
+		(cfg.customTLSConfig == nil || cfg.customTLSConfig.ClientCAs == nil) {
+		cerr.add(fmt.Errorf("verifying client certificates requires a client CA bundle"))
+	}
+}
+
+// mutualTLS is true if client certificates are requested or verified
+func (cfg *Config) mutualTLS() bool {
+	if cfg.Insecure {
+		return false
+	}
+	if cfg.customTLSConfig != nil && cfg.customTLSConfig.ClientAuth != tls.NoClientCert {
+		return true
+	}
+	return cfg.ClientAuth != tls.NoClientCert
+}
+
+// hasCertificate is true if a custom TLS configuration provides its own certificate
+func hasCertificate(tlsConfig *tls.Config) bool {
+	return tlsConfig != nil && (len(tlsConfig.Certificates) > 0 || tlsConfig.GetCertificate != nil)
+}
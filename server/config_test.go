@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		errors []string // each is a substring of one of the reported errors
+	}{
+		{name: "defaults"},
+		{
+			name:   "port out of range",
+			opts:   []Option{WithHTTPListenPort(70000)},
+			errors: []string{"HTTP port 70000 is out of range"},
+		},
+		{
+			name:   "ports collide",
+			opts:   []Option{WithHTTPListenPort(9000), WithMetricsListenPort(9000)},
+			errors: []string{"metrics port 9000 is already in use by the HTTP listener"},
+		},
+		{
+			name: "ephemeral ports may repeat",
+			opts: []Option{WithHTTPListenPort(0), WithMetricsListenPort(0)},
+		},
+		{
+			name:   "certificate without a key",
+			opts:   []Option{WithCertificate("server.pem", "")},
+			errors: []string{"certificate server.pem was provided without a key"},
+		},
+		{
+			name:   "unreadable certificate",
+			opts:   []Option{WithCertificate("missing.pem", "missing.key")},
+			errors: []string{"unable to load certificate/key pair"},
+		},
+		{
+			name:   "TLS without a certificate",
+			opts:   []Option{WithTLSConfig(&tls.Config{})},
+			errors: []string{"TLS requested, but no certificate was provided"},
+		},
+		{
+			name:   "client CA without TLS",
+			opts:   []Option{WithClientCA("missing-ca.pem")},
+			errors: []string{"requires a server certificate", "unable to read client CA bundle"},
+		},
+		{
+			name:   "verifying client certificates without a CA",
+			opts:   []Option{WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{{}}}), WithClientAuth(tls.RequireAndVerifyClientCert)},
+			errors: []string{"verifying client certificates requires a client CA bundle"},
+		},
+		{
+			name: "every problem is reported",
+			opts: []Option{
+				WithCertificateReloadPeriod(-time.Second),
+				WithDrainDelay(-time.Second),
+				WithShutdownTimeout(0),
+				WithTLSProfile(TLSProfile(42)),
+			},
+			errors: []string{
+				"certificate reload period -1s is negative",
+				"drain delay -1s is negative",
+				"shutdown timeout 0s must be positive",
+				"42",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(testOptions(tt.opts...)...)
+			if len(tt.errors) == 0 {
+				if err != nil {
+					t.Fatalf("New() = %v", err)
+				}
+				return
+			}
+
+			cerr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("New() = %v, want a *ConfigError", err)
+			}
+			if len(cerr.Errors) != len(tt.errors) {
+				t.Errorf("%d errors reported, want %d: %v", len(cerr.Errors), len(tt.errors), cerr)
+			}
+			for _, want := range tt.errors {
+				if !strings.Contains(cerr.Error(), want) {
+					t.Errorf("%v does not report %q", cerr, want)
+				}
+			}
+		})
+	}
+}
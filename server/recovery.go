@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/mchudgins/go-service-helper/logger"
+	xcontext "golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recovered logs a panic raised by an RPC handler & converts it into
+// an Internal error for the caller, rather than crashing the process
+func recovered(log logger.Logger, method string, p interface{}) error {
+	log.Error("panic in gRPC handler",
+		logger.String("method", method),
+		logger.Any("panic", p),
+		logger.Stack("stack"))
+
+	return status.Errorf(codes.Internal, "%s: internal error", method)
+}
+
+func grpcRecovery(log logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx xcontext.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (rc interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(log, info.FullMethod, p)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+func grpcStreamRecovery(log logger.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(log, info.FullMethod, p)
+			}
+		}()
+
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCRecovery(t *testing.T) {
+	failed := status.Error(codes.NotFound, "not found")
+
+	tests := []struct {
+		name   string
+		handle func() error
+		code   codes.Code
+		logged bool
+	}{
+		{name: "succeeds", handle: func() error { return nil }, code: codes.OK},
+		{name: "fails", handle: func() error { return failed }, code: codes.NotFound},
+		{name: "panics", handle: func() error { panic("boom") }, code: codes.Internal, logged: true},
+		{name: "panics with an error", handle: func() error { panic(errors.New("boom")) }, code: codes.Internal, logged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("unary", func(t *testing.T) {
+				log := newCapturingLogger()
+				_, err := grpcRecovery(log)(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Method"},
+					func(ctx context.Context, req interface{}) (interface{}, error) { return nil, tt.handle() })
+				checkRecovered(t, log, err, tt.code, tt.logged)
+			})
+
+			t.Run("stream", func(t *testing.T) {
+				log := newCapturingLogger()
+				err := grpcStreamRecovery(log)(nil, nil, &grpc.StreamServerInfo{FullMethod: "/svc/Method"},
+					func(srv interface{}, stream grpc.ServerStream) error { return tt.handle() })
+				checkRecovered(t, log, err, tt.code, tt.logged)
+			})
+		})
+	}
+}
+
+func checkRecovered(t *testing.T, log *capturingLogger, err error, code codes.Code, logged bool) {
+	if got := status.Code(err); got != code {
+		t.Errorf("code = %s, want %s", got, code)
+	}
+	e, found := log.find("panic in gRPC handler")
+	if found != logged {
+		t.Errorf("panic logged = %t, want %t", found, logged)
+	}
+	if found && e.fields["method"] != "/svc/Method" {
+		t.Errorf("method = %v, want /svc/Method", e.fields["method"])
+	}
+}
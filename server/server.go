@@ -2,13 +2,18 @@ package server
 
 import (
 	"context"
-	"expvar"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -18,35 +23,62 @@ import (
 	"github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/grpc-ecosystem/grpc-opentracing/go/otgrpc"
 	"github.com/justinas/alice"
+	"github.com/mchudgins/go-service-helper/accessLog"
 	"github.com/mchudgins/go-service-helper/correlationID"
 	gsh "github.com/mchudgins/go-service-helper/handlers"
-	"github.com/mchudgins/playground/pkg/healthz"
+	"github.com/mchudgins/go-service-helper/health"
+	"github.com/mchudgins/go-service-helper/hystrix"
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/mchudgins/go-service-helper/route"
 	"github.com/mwitkow/go-grpc-middleware"
 	"github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type Config struct {
-	Insecure          bool
-	Compress          bool // if true, add compression handling to messages
-	UseZipkin         bool // if true, add zipkin tracing
-	CertFilename      string
-	KeyFilename       string
-	HTTPListenPort    int
-	RPCListenPort     int
-	MetricsListenPort int
-	Handler           http.Handler
-	Hostname          string // if present, enforce canonical hostnames
-	RPCRegister       RPCRegistration
-	logger            *zap.Logger
-	rpcServer         *grpc.Server
-	httpServer        *http.Server
-	metricsServer     *http.Server
-	serviceName       string
+	Insecure             bool
+	Compress             bool // if true, add compression handling to messages
+	UseZipkin            bool // if true, add zipkin tracing
+	CertFilename         string
+	KeyFilename          string
+	CertReloadPeriod     time.Duration      // how often to check the certificate files for changes (0 disables)
+	ClientCAFilename     string             // if present, PEM bundle used to verify client certificates
+	ClientAuth           tls.ClientAuthType // client certificate policy for both HTTPS & gRPC
+	TLSProfile           TLSProfile         // TLS versions & ciphers for both HTTPS & gRPC
+	HTTPListenPort       int
+	RPCListenPort        int
+	MetricsListenPort    int // admin endpoints: metrics, health, expvar, pprof & hystrix stream
+	Handler              http.Handler
+	Hostname             string        // if present, enforce canonical hostnames
+	PublicAdminEndpoints bool          // if true, also serve metrics, health & expvar on the HTTP port
+	DrainDelay           time.Duration // time between failing readiness & closing the listeners
+	ShutdownTimeout      time.Duration // time allowed for in-flight requests to complete
+	RPCRegister          RPCRegistration
+	logger               logger.Logger
+	serviceName          string
+	accessLog            *accessLog.AccessLogger
+	accessLogOptions     []accessLog.Option
+	clientCAs            *x509.CertPool
+	correlationID        *correlationID.Extractor
+	customTLSConfig      *tls.Config
+	headerPolicy         *gsh.HeaderPolicy
+	health               *health.Registry
+	httpMetrics          []gsh.MetricsOption
+	hystrixConfig        string
+	processDefaults      bool
+	healthChecks         []healthCheck
+	logSampler           *accessLog.Sampler
+	logSamplerOptions    []accessLog.SamplerOption
+	metrics              *metrics.Config
+	preShutdownHooks     []shutdownHook
+	postShutdownHooks    []shutdownHook
+	unaryInterceptors    []grpc.UnaryServerInterceptor
+	streamInterceptors   []grpc.StreamServerInterceptor
 }
 
 type Option func(*Config) error
@@ -54,9 +86,37 @@ type Option func(*Config) error
 type RPCRegistration func(*grpc.Server) error
 
 const (
-	zipkinHTTPEndpoint = "http://localhost:9411/api/v1/spans"
+	zipkinHTTPEndpoint    = "http://localhost:9411/api/v1/spans"
+	healthMonitorInterval = time.Duration(5) * time.Second
 )
 
+// healthCheck is a check registered by an Option, added to the
+// registry once all the options have been applied
+type healthCheck struct {
+	name      string
+	checker   health.Checker
+	opts      []health.Option
+	readiness bool
+}
+
+func (hc healthCheck) register(registry *health.Registry) error {
+	if hc.readiness {
+		return registry.RegisterReadiness(hc.name, hc.checker, hc.opts...)
+	}
+	return registry.RegisterLiveness(hc.name, hc.checker, hc.opts...)
+}
+
+// WithAccessLog writes an access log entry for each HTTP request, by
+// default in the Apache Combined format to os.Stdout.  An AsyncWriter
+// output is flushed & closed on shutdown.
+func WithAccessLog(opts ...accessLog.Option) Option {
+	return func(cfg *Config) error {
+		// built by validate, once the correlation ID is configured
+		cfg.accessLogOptions = append([]accessLog.Option{}, opts...)
+		return nil
+	}
+}
+
 func WithCanonicalHost(hostname string) Option {
 	return func(cfg *Config) error {
 		cfg.Hostname = hostname
@@ -74,6 +134,99 @@ func WithCertificate(certFilename, keyFilename string) Option {
 	}
 }
 
+// WithCertificateReloadPeriod sets how often the certificate and key files
+// are checked for changes.  A changed pair is swapped in without a restart;
+// a period of zero disables polling, leaving SIGHUP as the only trigger.
+func WithCertificateReloadPeriod(period time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.CertReloadPeriod = period
+		return nil
+	}
+}
+
+// WithClientAuth sets the policy for client certificates presented to
+// the HTTPS and gRPC listeners.  It defaults to tls.RequireAndVerifyClientCert
+// when WithClientCA is used.
+func WithClientAuth(mode tls.ClientAuthType) Option {
+	return func(cfg *Config) error {
+		cfg.ClientAuth = mode
+		return nil
+	}
+}
+
+// WithClientCA enables mutual TLS, verifying client certificates
+// against the CA certificates in the PEM encoded bundle.
+func WithClientCA(bundleFilename string) Option {
+	return func(cfg *Config) error {
+		cfg.ClientCAFilename = bundleFilename
+		if cfg.ClientAuth == tls.NoClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return nil
+	}
+}
+
+// WithCorrelationID configures how the HTTP & gRPC servers determine each
+// request's correlation ID: the headers consulted, the peers trusted to
+// supply one, & how new IDs are generated.  See correlationID.NewExtractor.
+// The request logs & the tracer use the same headers and, with
+// WithProcessDefaults, so do outbound clients & gRPC client interceptors.
+func WithCorrelationID(opts ...correlationID.Option) Option {
+	return func(cfg *Config) error {
+		extractor, err := correlationID.NewExtractor(opts...)
+		if err != nil {
+			return err
+		}
+		cfg.correlationID = extractor
+		return nil
+	}
+}
+
+// WithDrainDelay sets how long the server keeps serving, while reporting
+// itself as not ready, before it stops accepting connections.  This gives
+// load balancers (e.g. Kubernetes endpoints) time to deregister the instance.
+func WithDrainDelay(delay time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.DrainDelay = delay
+		return nil
+	}
+}
+
+// WithHeaderPolicy sets which request headers & query parameters the
+// HTTP request log, and which metadata the gRPC request log, includes;
+// by default, handlers.DefaultHeaderPolicy().
+func WithHeaderPolicy(policy gsh.HeaderPolicy) Option {
+	return func(cfg *Config) error {
+		cfg.headerPolicy = &policy
+		return nil
+	}
+}
+
+// WithHealthRegistry uses the given registry for the liveness & readiness
+// checks instead of creating one.
+func WithHealthRegistry(registry *health.Registry) Option {
+	return func(cfg *Config) error {
+		if registry == nil {
+			return fmt.Errorf("WithHealthRegistry requires a non-nil registry")
+		}
+		cfg.health = registry
+		return nil
+	}
+}
+
+// WithHystrixConfig configures the circuit breakers from a JSON or YAML
+// file (see hystrix.LoadFile), which is reloaded whenever the process
+// receives a SIGHUP.
+func WithHystrixConfig(filename string) Option {
+	return func(cfg *Config) error {
+		if err := hystrix.LoadFile(filename); err != nil {
+			return fmt.Errorf("unable to load the circuit breaker configuration: %s", err)
+		}
+		cfg.hystrixConfig = filename
+		return nil
+	}
+}
+
 func WithHTTPListenPort(port int) Option {
 	return func(cfg *Config) error {
 		cfg.HTTPListenPort = port
@@ -81,6 +234,20 @@ func WithHTTPListenPort(port int) Option {
 	}
 }
 
+// WithHTTPMetrics configures the HTTP request metrics (see
+// handlers.NewHTTPMetrics).  Requests are labelled with their route,
+// which is recorded automatically when the WithHTTPServer handler is a
+// gorilla mux Router or an ActuatorMux; other handlers should call
+// route.Set, or be given a handlers.URLNormalizer here, otherwise their
+// requests are labelled handlers.UnmatchedURL.  The original metrics are
+// also recorded, unless handlers.LegacyMetrics(false) is given.
+func WithHTTPMetrics(opts ...gsh.MetricsOption) Option {
+	return func(cfg *Config) error {
+		cfg.httpMetrics = append(cfg.httpMetrics, opts...)
+		return nil
+	}
+}
+
 func WithHTTPServer(h http.Handler) Option {
 	return func(cfg *Config) error {
 		cfg.Handler = h
@@ -88,9 +255,49 @@ func WithHTTPServer(h http.Handler) Option {
 	}
 }
 
+// WithLogger logs to the given zap logger.  It is shorthand for
+// WithStructuredLogger(logger.NewZap(l)).
 func WithLogger(l *zap.Logger) Option {
 	return func(cfg *Config) error {
-		cfg.logger = l
+		if l != nil {
+			cfg.logger = logger.NewZap(l)
+		}
+		return nil
+	}
+}
+
+// WithLogSampler logs only a sample of the HTTP requests, per the rules;
+// errors, and requests slower than the AlwaysLogSlowerThan option, are
+// always logged.  Pass accessLog.WithSampler to WithAccessLog to sample
+// the access log, too.
+func WithLogSampler(opts ...accessLog.SamplerOption) Option {
+	return func(cfg *Config) error {
+		cfg.logSamplerOptions = append(cfg.logSamplerOptions, opts...)
+		return nil
+	}
+}
+
+// WithLivenessCheck registers a check which, if failing, indicates the
+// process should be restarted.  It is published on /healthz and as the
+// "liveness" gRPC health service.
+func WithLivenessCheck(name string, checker health.Checker, opts ...health.Option) Option {
+	return func(cfg *Config) error {
+		cfg.healthChecks = append(cfg.healthChecks, healthCheck{name: name, checker: checker, opts: opts})
+		return nil
+	}
+}
+
+// WithMetrics registers the server's metrics, and those of the HTTP
+// middleware, certificate manager, gRPC interceptors & circuit breakers,
+// per the options (e.g. with a custom registry or a namespace), rather
+// than with prometheus.DefaultRegisterer.  /metrics serves the Gatherer.
+func WithMetrics(opts ...metrics.Option) Option {
+	return func(cfg *Config) error {
+		m, err := metrics.New(opts...)
+		if err != nil {
+			return err
+		}
+		cfg.metrics = m
 		return nil
 	}
 }
@@ -102,6 +309,54 @@ func WithMetricsListenPort(port int) Option {
 	}
 }
 
+// WithPublicAdminEndpoints also publishes /metrics, /healthz, /readyz and
+// /debug/vars on the public HTTP port.  By default they are only served
+// by the admin (metrics) listener, so they are never proxied to end users.
+func WithPublicAdminEndpoints(enabled bool) Option {
+	return func(cfg *Config) error {
+		cfg.PublicAdminEndpoints = enabled
+		return nil
+	}
+}
+
+// WithReadinessCheck registers a check which, if failing, indicates the
+// process should not receive traffic.  It is published on /readyz and as
+// both the overall ("") and "readiness" gRPC health services.
+func WithReadinessCheck(name string, checker health.Checker, opts ...health.Option) Option {
+	return func(cfg *Config) error {
+		cfg.healthChecks = append(cfg.healthChecks, healthCheck{name: name, checker: checker, opts: opts, readiness: true})
+		return nil
+	}
+}
+
+// WithPreShutdownHook registers a function to run as soon as shutdown
+// begins, after the instance is reported as not ready.  Hooks run in the
+// order they are registered.
+func WithPreShutdownHook(name string, hook ShutdownHook, opts ...ShutdownHookOption) Option {
+	return func(cfg *Config) error {
+		if hook == nil {
+			return fmt.Errorf("pre-shutdown hook %s is nil", name)
+		}
+		cfg.preShutdownHooks = append(cfg.preShutdownHooks, newShutdownHook(name, hook, opts))
+		return nil
+	}
+}
+
+// WithProcessDefaults makes the server, once started, the owner of the
+// process wide defaults: its logger becomes logger.Default(), so that
+// every package logs to one stream, its correlation ID Extractor becomes
+// correlationID.Default(), so that outbound requests carry the ID in the
+// same header, its tracer becomes opentracing's global tracer, and the
+// circuit breakers' metrics are exported with the server's.  Run does
+// so; embedded servers should only do so if they are the process's only
+// server.
+func WithProcessDefaults() Option {
+	return func(cfg *Config) error {
+		cfg.processDefaults = true
+		return nil
+	}
+}
+
 func WithRPCListenPort(port int) Option {
 	return func(cfg *Config) error {
 		cfg.RPCListenPort = port
@@ -124,6 +379,90 @@ func WithServiceName(serviceName string) Option {
 	}
 }
 
+// WithShutdownHook registers a function to release application resources
+// (flush buffers, close database pools, sync loggers, ...) once the
+// listeners have stopped and in-flight requests are complete.  Hooks run
+// in the order they are registered, each limited by its own timeout.
+func WithShutdownHook(name string, hook ShutdownHook, opts ...ShutdownHookOption) Option {
+	return func(cfg *Config) error {
+		if hook == nil {
+			return fmt.Errorf("shutdown hook %s is nil", name)
+		}
+		cfg.postShutdownHooks = append(cfg.postShutdownHooks, newShutdownHook(name, hook, opts))
+		return nil
+	}
+}
+
+// WithShutdownTimeout sets how long in-flight requests are given to
+// complete, once the listeners are closed, before connections are
+// forcibly closed.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.ShutdownTimeout = timeout
+		return nil
+	}
+}
+
+// WithStreamInterceptors appends application interceptors to the gRPC
+// server's streaming chain.  They run after the built-in interceptors,
+// so the stream's context already carries the correlation ID, the
+// client identity & the tracing span.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(cfg *Config) error {
+		cfg.streamInterceptors = append(cfg.streamInterceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithStructuredLogger sets the logger used by the server and, with
+// WithProcessDefaults, by the handlers, hystrix & actuator packages.
+// Every entry carries the service name, if one is set.
+func WithStructuredLogger(l logger.Logger) Option {
+	return func(cfg *Config) error {
+		if l == nil {
+			return fmt.Errorf("WithStructuredLogger requires a non-nil logger.Logger")
+		}
+		cfg.logger = l
+		return nil
+	}
+}
+
+// WithTLSConfig replaces the TLS profile with a fully custom configuration
+// for both the HTTPS and gRPC listeners.  Unless the configuration provides
+// its own certificates, the files from WithCertificate are used; the client
+// CA and client auth options are applied on top of it.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(cfg *Config) error {
+		if tlsConfig == nil {
+			return fmt.Errorf("WithTLSConfig requires a non-nil *tls.Config")
+		}
+		cfg.customTLSConfig = tlsConfig.Clone()
+		cfg.Insecure = false
+		return nil
+	}
+}
+
+// WithTLSProfile selects the Mozilla guideline used to configure TLS
+// for both the HTTPS and gRPC listeners.
+func WithTLSProfile(profile TLSProfile) Option {
+	return func(cfg *Config) error {
+		if _, err := tlsConfigFactory(profile); err != nil {
+			return err
+		}
+		cfg.TLSProfile = profile
+		return nil
+	}
+}
+
+// WithUnaryInterceptors appends application interceptors to the gRPC
+// server's unary chain, after the built-in interceptors.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(cfg *Config) error {
+		cfg.unaryInterceptors = append(cfg.unaryInterceptors, interceptors...)
+		return nil
+	}
+}
+
 func WithZipkinTracer() Option {
 	return func(cfg *Config) error {
 		cfg.UseZipkin = true
@@ -131,207 +470,685 @@ func WithZipkinTracer() Option {
 	}
 }
 
-func Run(ctx context.Context, opts ...Option) {
+// Server is a handle on the HTTP, gRPC and metrics listeners configured
+// by a set of Options.  It is created with New, started with Start and
+// stopped with Shutdown (or by cancelling the context given to Start).
+type Server struct {
+	cfg *Config
+
+	httpServer    *http.Server
+	rpcServer     *grpc.Server
+	metricsServer *http.Server
+	hystrixStream *afex.StreamHandler
+
+	httpListener    net.Listener
+	rpcListener     net.Listener
+	metricsListener net.Listener
+
+	certs             *certManager
+	tracer            opentracing.Tracer
+	collector         io.Closer // zipkin span collector
+	ready             int32     // non-zero while this instance should receive traffic
+	started           int32     // non-zero once Start has been called
+	stopHealthMonitor context.CancelFunc
+	stopHystrixWatch  context.CancelFunc
+
+	errc  chan eventSource
+	stopc chan context.Context
+	done  chan struct{}
+	err   error
+
+	startOnce sync.Once
+}
+
+// New returns a Server configured by the given options.  If any option
+// fails or the resulting configuration is inconsistent, a *ConfigError
+// describing every problem is returned.  No listeners are opened until
+// Start is called.
+func New(opts ...Option) (*Server, error) {
 
 	// default config
 	cfg := &Config{
 		Insecure:          true,
+		CertReloadPeriod:  time.Duration(1) * time.Minute,
 		HTTPListenPort:    8443,
 		MetricsListenPort: 8080,
 		RPCListenPort:     50050,
+		ShutdownTimeout:   time.Duration(5) * time.Second,
 	}
 
-	// process the Run() options
+	// process the New() options, then validate the result,
+	// reporting every problem rather than just the first
+	cerr := &ConfigError{}
 	for _, o := range opts {
-		o(cfg)
+		cerr.add(o(cfg))
+	}
+	cfg.validate(cerr)
+
+	s := &Server{
+		cfg:   cfg,
+		errc:  make(chan eventSource, 4),
+		stopc: make(chan context.Context, 1),
+		done:  make(chan struct{}),
+	}
+
+	// this instance is only ready while it is serving
+	cerr.add(cfg.health.RegisterReadiness("serving", health.CheckerFunc(s.serving)))
+	for _, hc := range cfg.healthChecks {
+		cerr.add(hc.register(cfg.health))
+	}
+
+	// flush the access log, then any buffered spans, once everything else is done
+	if cfg.accessLog != nil {
+		cfg.postShutdownHooks = append(cfg.postShutdownHooks,
+			newShutdownHook("access log", func(context.Context) error { return cfg.accessLog.Close() }, nil))
+	}
+	if cfg.UseZipkin {
+		cfg.postShutdownHooks = append(cfg.postShutdownHooks,
+			newShutdownHook("zipkin collector", s.closeTracer, nil))
 	}
 
-	// make a channel to listen on events,
-	// then launch the servers.
+	if len(cerr.Errors) > 0 {
+		return nil, cerr
+	}
+
+	return s, nil
+}
+
+// Health returns the registry of liveness & readiness checks, which may
+// be extended until the server is shut down.
+func (s *Server) Health() *health.Registry {
+	return s.cfg.health
+}
+
+// serving is a readiness check which fails before Start and during shutdown
+func (s *Server) serving(ctx context.Context) error {
+	if atomic.LoadInt32(&s.ready) == 0 {
+		return errNotServing
+	}
+	return nil
+}
+
+// Run constructs a Server from the options, starts it and blocks until
+// it terminates, either because ctx was cancelled, a SIGINT/SIGTERM was
+// received or one of the listeners failed.  Run ends the process with
+// os.Exit; use New, Start and Wait to embed the server instead.
+func Run(ctx context.Context, opts ...Option) {
+	s, err := New(append([]Option{WithProcessDefaults()}, opts...)...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	errc := make(chan eventSource)
-	defer close(errc)
+	if err = s.Start(ctx); err != nil {
+		s.cfg.logger.Error("unable to start server", logger.Err(err))
+		os.Exit(1)
+	}
 
 	// interrupt handler
 	go func() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		errc <- eventSource{
-			source: interrupt,
-			err:    fmt.Errorf("%s", <-c),
+		defer signal.Stop(c)
+
+		select {
+		case sig := <-c:
+			s.notify(eventSource{
+				source: interrupt,
+				err:    fmt.Errorf("%s", sig),
+			})
+		case <-s.done:
 		}
 	}()
 
-	// gRPC server
-	if cfg.RPCRegister != nil {
-		go func() {
-			rpcListenPort := ":" + strconv.Itoa(cfg.RPCListenPort)
-			lis, err := net.Listen("tcp", rpcListenPort)
-			if err != nil {
-				errc <- eventSource{
-					err:    err,
-					source: rpcServer,
-				}
-				return
-			}
+	os.Exit(exitCode(s.Wait()))
+}
 
-			// configure the RPC server
-			var grpcMiddleware grpc.ServerOption
-			if cfg.UseZipkin {
-				grpcMiddleware = grpc_middleware.WithUnaryServerChain(
-					grpc_prometheus.UnaryServerInterceptor,
-					otgrpc.OpenTracingServerInterceptor(opentracing.GlobalTracer(), otgrpc.LogPayloads()),
-					grpcEndpointLog(cfg.logger, cfg.serviceName))
-			} else {
-				grpcMiddleware = grpc_middleware.WithUnaryServerChain(
-					grpc_prometheus.UnaryServerInterceptor,
-					grpcEndpointLog(cfg.logger, cfg.serviceName))
-			}
+// Start opens the configured listeners and begins serving on them.  It
+// returns once the listeners are bound; the server keeps running until
+// ctx is cancelled, Shutdown is called or a listener fails.
+func (s *Server) Start(ctx context.Context) error {
+	err := errAlreadyStarted
+	s.startOnce.Do(func() {
+		atomic.StoreInt32(&s.started, 1)
+		err = s.start(ctx)
+	})
 
-			if cfg.Insecure {
-				cfg.rpcServer = grpc.NewServer(
-					grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
-					grpcMiddleware)
-			} else {
-				tlsCreds, err := credentials.NewServerTLSFromFile(cfg.CertFilename, cfg.KeyFilename)
-				if err != nil {
-					cfg.logger.Fatal("Failed to generate grpc TLS credentials", zap.Error(err))
-				}
-				cfg.rpcServer = grpc.NewServer(
-					grpc.Creds(tlsCreds),
-					grpc.RPCCompressor(grpc.NewGZIPCompressor()),
-					grpc.RPCDecompressor(grpc.NewGZIPDecompressor()),
-					grpcMiddleware)
-			}
+	return err
+}
 
-			cfg.RPCRegister(cfg.rpcServer)
+func (s *Server) start(ctx context.Context) error {
+	cfg := s.cfg
 
-			// register w. prometheus
-			grpc_prometheus.Register(cfg.rpcServer)
-			grpc_prometheus.EnableHandlingTimeHistogram()
+	var err error
+	if cfg.processDefaults {
+		// export the circuit breakers' metrics alongside the server's
+		err = hystrix.RegisterMetrics(cfg.metrics)
 
-			// run the server & send an event upon termination
-			errc <- eventSource{
-				err:    cfg.rpcServer.Serve(lis),
+		// one log stream: the other packages log via the default logger
+		if err == nil {
+			logger.SetDefault(cfg.logger)
+			correlationID.SetDefault(cfg.correlationID)
+		}
+	}
+
+	if err == nil && len(cfg.CertFilename) > 0 {
+		s.certs, err = newCertManager(cfg.CertFilename, cfg.KeyFilename, cfg.logger, cfg.metrics)
+	}
+
+	// bind all the listeners up front, so a port collision is reported
+	// to the caller rather than discovered later
+	if err == nil {
+		err = s.listen()
+	}
+
+	endpoints := s.instanceHandlers()
+	if err == nil && cfg.UseZipkin {
+		err = s.newTracer()
+	}
+	if err == nil && s.rpcListener != nil {
+		err = s.newRPCServer()
+	}
+	if err == nil && s.httpListener != nil {
+		err = s.newHTTPServer(endpoints)
+	}
+	if err != nil {
+		s.closeListeners()
+		s.closeTracer(ctx)
+		s.err = err
+		close(s.done)
+		return err
+	}
+	s.newAdminServer(endpoints)
+
+	if s.certs != nil {
+		go s.certs.watch(cfg.CertReloadPeriod)
+	}
+
+	// launch the servers, each sends an event upon termination
+
+	if s.rpcServer != nil {
+		go func() {
+			s.notify(eventSource{
+				err:    s.rpcServer.Serve(s.rpcListener),
 				source: rpcServer,
-			}
+			})
 		}()
 	}
 
-	// http/https server
-	if cfg.Handler != nil {
+	if s.httpServer != nil {
 		go func() {
-			rootMux := mux.NewRouter()
-
-			hc, err := healthz.NewConfig()
-			healthzHandler, err := healthz.Handler(hc)
-			if err != nil {
-				cfg.logger.Panic("Constructing healthz.Handler", zap.Error(err))
+			var err error
+			if cfg.Insecure {
+				err = s.httpServer.Serve(s.httpListener)
+			} else {
+				err = s.httpServer.ServeTLS(s.httpListener, "", "")
 			}
 
-			// TODO: move these three handlers to the metrics listener
-			// set up handlers for THIS instance
-			// (these are not expected to be proxied)
-			rootMux.Handle("/debug/vars", expvar.Handler())
-			rootMux.Handle("/healthz", healthzHandler)
-			rootMux.Handle("/metrics", prometheus.Handler())
+			s.notify(eventSource{
+				err:    err,
+				source: httpServer,
+			})
+		}()
+	}
 
-			rootMux.PathPrefix("/").Handler(cfg.Handler)
+	go func() {
+		s.notify(eventSource{
+			err:    s.metricsServer.Serve(s.metricsListener),
+			source: metricsServer,
+		})
+	}()
 
-			chain := alice.New(gsh.HTTPMetricsCollector, gsh.HTTPLogrusLogger)
+	atomic.StoreInt32(&s.ready, 1)
+	s.logLaunch()
 
-			if cfg.UseZipkin {
-				var tracer func(http.Handler) http.Handler
-				tracer = gsh.TracerFromHTTPRequest(gsh.NewTracer("commandName"), "proxy")
-				chain = chain.Append(tracer)
-			} else {
-				chain = chain.Append(func(next http.Handler) http.Handler {
-					return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	healthCtx, cancel := context.WithCancel(context.Background())
+	s.stopHealthMonitor = cancel
+	go cfg.health.Monitor(healthCtx, healthMonitorInterval)
 
-						// tag this request with a correlation ID, so we can troubleshoot it later, if necessary
-						req, corrID, fExisted := correlationID.FromRequest(req)
+	if len(cfg.hystrixConfig) > 0 {
+		watchCtx, cancel := context.WithCancel(context.Background())
+		s.stopHystrixWatch = cancel
+		go s.watchHystrixConfig(watchCtx)
+	}
 
-						// if we're at the edge of the system, send the correlation ID back in the response
-						if !fExisted {
-							w.Header().Set(correlationID.CORRID, corrID)
-						}
+	go s.monitor(ctx)
 
-						next.ServeHTTP(w, req)
-					})
+	return nil
+}
 
-				})
-			}
+// Shutdown gracefully stops the server, waiting for in-flight requests
+// until ctx expires.  It returns the same result as Wait.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if atomic.LoadInt32(&s.started) == 0 {
+		return errNotServing
+	}
 
-			if len(cfg.Hostname) > 0 {
-				canonical := handlers.CanonicalHost(cfg.Hostname, http.StatusPermanentRedirect)
-				chain = chain.Append(canonical)
-			}
+	select {
+	case s.stopc <- ctx:
+	default:
+		// a shutdown is already underway
+	}
 
-			if cfg.Compress {
-				chain = chain.Append(handlers.CompressHandler)
-			}
+	select {
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-			httpListenAddress := ":" + strconv.Itoa(cfg.HTTPListenPort)
-			cfg.httpServer = &http.Server{
-				Addr:              httpListenAddress,
-				Handler:           chain.Then(rootMux),
-				ReadTimeout:       time.Duration(5) * time.Second,
-				ReadHeaderTimeout: time.Duration(2) * time.Second,
-				TLSConfig:         tlsConfigFactory(),
-			}
+// Wait blocks until the server has shut down.  It returns nil if the
+// shutdown was requested and completed cleanly, otherwise the error
+// which caused the server to terminate.  If the server was never
+// started, it returns at once.
+func (s *Server) Wait() error {
+	if atomic.LoadInt32(&s.started) == 0 {
+		return errNotServing
+	}
 
-			if cfg.Insecure {
-				err = cfg.httpServer.ListenAndServe()
-			} else {
-				err = cfg.httpServer.ListenAndServeTLS(cfg.CertFilename, cfg.KeyFilename)
-			}
+	<-s.done
+	return s.err
+}
 
-			errc <- eventSource{
-				err:    err,
-				source: httpServer,
+// HTTPAddr returns the address the HTTP(S) server is bound to, or nil
+// if no HTTP handler was configured or the server has not been started.
+func (s *Server) HTTPAddr() net.Addr {
+	return listenerAddr(s.httpListener)
+}
+
+// RPCAddr returns the address the gRPC server is bound to, or nil
+// if no RPC registration was configured or the server has not been started.
+func (s *Server) RPCAddr() net.Addr {
+	return listenerAddr(s.rpcListener)
+}
+
+// MetricsAddr returns the address the metrics server is bound to, or nil
+// if the server has not been started.
+func (s *Server) MetricsAddr() net.Addr {
+	return listenerAddr(s.metricsListener)
+}
+
+func listenerAddr(lis net.Listener) net.Addr {
+	if lis == nil {
+		return nil
+	}
+	return lis.Addr()
+}
+
+func (s *Server) listen() error {
+	var err error
+
+	if s.cfg.RPCRegister != nil {
+		s.rpcListener, err = net.Listen("tcp", ":"+strconv.Itoa(s.cfg.RPCListenPort))
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.Handler != nil {
+		s.httpListener, err = net.Listen("tcp", ":"+strconv.Itoa(s.cfg.HTTPListenPort))
+		if err != nil {
+			return err
+		}
+	}
+
+	s.metricsListener, err = net.Listen("tcp", ":"+strconv.Itoa(s.cfg.MetricsListenPort))
+	return err
+}
+
+func (s *Server) closeListeners() {
+	for _, lis := range []net.Listener{s.rpcListener, s.httpListener, s.metricsListener} {
+		if lis != nil {
+			lis.Close()
+		}
+	}
+}
+
+// notify delivers a termination event without ever blocking the sender
+func (s *Server) notify(evt eventSource) {
+	select {
+	case s.errc <- evt:
+	default:
+	}
+}
+
+// monitor waits for the first termination event and then shuts
+// everything down gracefully, if possible
+func (s *Server) monitor(ctx context.Context) {
+	defer close(s.done)
+
+	var evt eventSource
+	shutdownCtx := context.Background()
+
+	select {
+	case evt = <-s.errc:
+	case <-ctx.Done():
+		evt = eventSource{source: interrupt, err: ctx.Err()}
+	case shutdownCtx = <-s.stopc:
+		evt = eventSource{source: interrupt, err: errShutdownRequested}
+	}
+
+	if s.certs != nil {
+		defer s.certs.stop()
+	}
+	if s.stopHealthMonitor != nil {
+		defer s.stopHealthMonitor()
+	}
+	if s.stopHystrixWatch != nil {
+		defer s.stopHystrixWatch()
+	}
+
+	s.err = s.performGracefulShutdown(shutdownCtx, evt)
+}
+
+// watchHystrixConfig reloads the circuit breaker configuration whenever
+// the process receives a SIGHUP
+func (s *Server) watchHystrixConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-hup:
+			s.cfg.logger.Info("SIGHUP received, reloading circuit breaker configuration",
+				logger.String("filename", s.cfg.hystrixConfig))
+			if err := hystrix.LoadFile(s.cfg.hystrixConfig); err != nil {
+				s.cfg.logger.Error("unable to reload circuit breaker configuration; continuing with the current configuration", logger.Err(err))
 			}
-		}()
+		}
 	}
+}
 
-	// start the hystrix stream provider
-	go func() {
-		hystrixStreamHandler := afex.NewStreamHandler()
-		hystrixStreamHandler.Start()
-		listenPort := ":" + strconv.Itoa(cfg.MetricsListenPort)
-		cfg.metricsServer = &http.Server{
-			Addr:    listenPort,
-			Handler: hystrixStreamHandler,
+// newTracerAndCollector is replaced by tests
+var newTracerAndCollector = gsh.NewTracerAndCollector
+
+// newTracer sets up the zipkin tracer for both the HTTP & gRPC servers
+func (s *Server) newTracer() error {
+	serviceName := s.cfg.serviceName
+	if len(serviceName) == 0 {
+		serviceName = filepath.Base(os.Args[0])
+	}
+
+	tracer, collector, err := newTracerAndCollector(serviceName)
+	if err != nil {
+		return err
+	}
+	s.tracer, s.collector = tracer, collector
+
+	// spans started without a tracer, e.g. by zipkin.TraceClient, go to
+	// the process's server
+	if s.cfg.processDefaults {
+		opentracing.SetGlobalTracer(tracer)
+	}
+	return nil
+}
+
+// closeTracer is a shutdown hook which flushes the tracer's collector
+func (s *Server) closeTracer(ctx context.Context) error {
+	if s.collector == nil {
+		return nil
+	}
+	collector := s.collector
+	s.collector = nil
+	return collector.Close()
+}
+
+// tagCorrelationID is the HTTP middleware which tags each request with its
+// correlation ID
+func (s *Server) tagCorrelationID(next http.Handler) http.Handler {
+	extractor := s.cfg.correlationID
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req, corrID, fExisted := extractor.FromRequest(req)
+
+		// if we're at the edge of the system, send the correlation ID back in the response
+		if !fExisted {
+			w.Header().Set(extractor.Header(), corrID)
 		}
 
-		errc <- eventSource{
-			err:    cfg.metricsServer.ListenAndServe(),
-			source: metricsServer,
+		next.ServeHTTP(w, req)
+	})
+}
+
+// unrouted clears the route recorded for the catch-all "/" prefix, so
+// that requests the application handler does not route are reported
+// as unmatched, not "/".  The routes of an application gorilla mux are
+// recorded, as are the server's own, without modifying its Router.
+func unrouted(next http.Handler) http.Handler {
+	if router, ok := next.(*mux.Router); ok {
+		next = route.MuxHandler(router)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route.Set(req.Context(), "")
+		next.ServeHTTP(w, req)
+	})
+}
+
+// tlsConfig returns the TLS configuration shared by the HTTPS and gRPC
+// listeners; the server certificate is obtained from the certManager so
+// that rotated certificates are used for new connections.
+func (s *Server) tlsConfig() *tls.Config {
+	var tlsConfig *tls.Config
+	if s.cfg.customTLSConfig != nil {
+		tlsConfig = s.cfg.customTLSConfig.Clone()
+	} else {
+		// the profile was checked by validate()
+		tlsConfig, _ = tlsConfigFactory(s.cfg.TLSProfile)
+	}
+
+	if s.certs != nil && len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil {
+		tlsConfig.GetCertificate = s.certs.GetCertificate
+	}
+	if s.cfg.ClientAuth != tls.NoClientCert {
+		tlsConfig.ClientAuth = s.cfg.ClientAuth
+	}
+	if s.cfg.clientCAs != nil {
+		tlsConfig.ClientCAs = s.cfg.clientCAs
+	}
+
+	return tlsConfig
+}
+
+func (s *Server) newRPCServer() error {
+	cfg := s.cfg
+
+	grpcMetrics, err := newGRPCMetrics(cfg.metrics)
+	if err != nil {
+		return err
+	}
+
+	// configure the RPC server; panics are recovered inside the
+	// prometheus interceptor so they are counted as Internal errors
+	unary := []grpc.UnaryServerInterceptor{
+		grpcMetrics.UnaryServerInterceptor(),
+		grpcRecovery(cfg.logger),
+		cfg.correlationID.UnaryServerInterceptor(),
+		grpcRequestLogger(cfg.logger),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		grpcMetrics.StreamServerInterceptor(),
+		grpcStreamRecovery(cfg.logger),
+		cfg.correlationID.StreamServerInterceptor(),
+		grpcStreamRequestLogger(cfg.logger),
+	}
+
+	if cfg.mutualTLS() {
+		unary = append(unary, grpcClientIdentity)
+		stream = append(stream, grpcStreamClientIdentity)
+	}
+	if cfg.UseZipkin {
+		unary = append(unary,
+			otgrpc.OpenTracingServerInterceptor(s.tracer, otgrpc.LogPayloads()))
+		stream = append(stream,
+			otgrpc.OpenTracingStreamServerInterceptor(s.tracer))
+	}
+	// metadata is logged per the HTTP header policy, so credentials are
+	// never logged
+	policy := gsh.DefaultHeaderPolicy()
+	if cfg.headerPolicy != nil {
+		policy = *cfg.headerPolicy
+	}
+	filter := policy.Filter()
+	unary = append(unary, grpcEndpointLog(cfg.logger, cfg.serviceName, filter))
+	stream = append(stream, grpcStreamEndpointLog(cfg.logger, cfg.serviceName, filter))
+
+	unary = append(unary, cfg.unaryInterceptors...)
+	stream = append(stream, cfg.streamInterceptors...)
+
+	grpcMiddleware := []grpc.ServerOption{
+		grpc_middleware.WithUnaryServerChain(unary...),
+		grpc_middleware.WithStreamServerChain(stream...),
+	}
+
+	if cfg.Insecure {
+		s.rpcServer = grpc.NewServer(grpcMiddleware...)
+	} else {
+		s.rpcServer = grpc.NewServer(append(grpcMiddleware,
+			grpc.Creds(credentials.NewTLS(s.tlsConfig())),
+			grpc.RPCCompressor(grpc.NewGZIPCompressor()),
+			grpc.RPCDecompressor(grpc.NewGZIPDecompressor()))...)
+	}
+
+	if err := cfg.RPCRegister(s.rpcServer); err != nil {
+		return err
+	}
+
+	// publish the health checks, unless the application has its own
+	if _, ok := s.rpcServer.GetServiceInfo()["grpc.health.v1.Health"]; !ok {
+		grpc_health_v1.RegisterHealthServer(s.rpcServer, cfg.health.GRPCServer())
+	}
+
+	// export a zero value for each method
+	grpcMetrics.InitializeMetrics(s.rpcServer)
+
+	return nil
+}
+
+// newGRPCMetrics returns the gRPC server metrics, with handling time
+// histograms, registered per m
+func newGRPCMetrics(m *metrics.Config) (*grpc_prometheus.ServerMetrics, error) {
+	counterOpts := m.CounterOpts("", "")
+	histogramOpts := m.HistogramOpts("", "", nil)
+
+	grpcMetrics := grpc_prometheus.NewServerMetrics(func(o *prometheus.CounterOpts) {
+		o.Namespace = counterOpts.Namespace
+		o.Subsystem = counterOpts.Subsystem
+		o.ConstLabels = counterOpts.ConstLabels
+	})
+	grpcMetrics.EnableHandlingTimeHistogram(func(o *prometheus.HistogramOpts) {
+		o.Namespace = histogramOpts.Namespace
+		o.Subsystem = histogramOpts.Subsystem
+		o.ConstLabels = histogramOpts.ConstLabels
+	})
+
+	// a second server shares the metrics already registered
+	c, err := m.Register(grpcMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.(*grpc_prometheus.ServerMetrics), nil
+}
+
+func (s *Server) newHTTPServer(endpoints map[string]http.Handler) error {
+	cfg := s.cfg
+
+	rootMux := mux.NewRouter()
+
+	// the instance endpoints live on the admin listener; only
+	// publish them here if explicitly asked to
+	if cfg.PublicAdminEndpoints {
+		for path, handler := range endpoints {
+			rootMux.Handle(path, handler)
 		}
-	}()
+	}
+
+	rootMux.PathPrefix("/").Handler(unrouted(cfg.Handler))
+
+	// record the matched route, for the request scoped logger
+	rootMux.Use(route.MuxMiddleware)
+
+	// log each request, per the header policy & sampler
+	httpLoggerOptions := []gsh.HTTPLoggerOption{gsh.Logger(cfg.logger), gsh.CorrelationID(cfg.correlationID)}
+	if cfg.headerPolicy != nil {
+		httpLoggerOptions = append(httpLoggerOptions, gsh.WithHeaderPolicy(*cfg.headerPolicy))
+	}
+	if cfg.logSampler != nil {
+		httpLoggerOptions = append(httpLoggerOptions, gsh.WithSampler(cfg.logSampler))
+	}
+
+	// the original metrics are recorded too, unless disabled by handlers.LegacyMetrics(false)
+	httpMetrics, err := gsh.NewHTTPMetrics(append([]gsh.MetricsOption{gsh.WithMetrics(cfg.metrics), gsh.LegacyMetrics(true)}, cfg.httpMetrics...)...)
+	if err != nil {
+		return err
+	}
+
+	// the span, correlation ID & client identity are added to the request
+	// before the logger, so that they appear in its entries
+	chain := alice.New(route.Handler)
+
+	if cfg.UseZipkin {
+		var tracer func(http.Handler) http.Handler
+		tracer = gsh.TracerFromHTTPRequest(s.tracer, "proxy", gsh.TracerCorrelationID(cfg.correlationID))
+		chain = chain.Append(tracer)
+	}
+
+	chain = chain.Append(s.tagCorrelationID)
+
+	if cfg.mutualTLS() {
+		chain = chain.Append(httpClientIdentity)
+	}
+
+	chain = chain.Append(httpMetrics, gsh.NewHTTPLogger(httpLoggerOptions...))
 
-	cfg.logLaunch()
+	if cfg.accessLog != nil {
+		chain = chain.Append(cfg.accessLog.Handler)
+	}
+
+	if len(cfg.Hostname) > 0 {
+		canonical := handlers.CanonicalHost(cfg.Hostname, http.StatusPermanentRedirect)
+		chain = chain.Append(canonical)
+	}
 
-	// wait for somthin'
-	rc := <-errc
+	if cfg.Compress {
+		chain = chain.Append(handlers.CompressHandler)
+	}
+
+	s.httpServer = &http.Server{
+		Addr:              s.httpListener.Addr().String(),
+		Handler:           chain.Then(rootMux),
+		ReadTimeout:       time.Duration(5) * time.Second,
+		ReadHeaderTimeout: time.Duration(2) * time.Second,
+	}
 
-	// somethin happened, now shut everything down gracefully, if possible
-	cfg.performGracefulShutdown(ctx, rc)
+	if !cfg.Insecure {
+		s.httpServer.TLSConfig = s.tlsConfig()
+	}
+
+	return nil
 }
 
-func (cfg *Config) logLaunch() {
-	serverList := make([]zapcore.Field, 0, 10)
+func (s *Server) logLaunch() {
+	cfg := s.cfg
+	serverList := make([]logger.Field, 0, 10)
 
-	if cfg.RPCRegister != nil {
-		serverList = append(serverList, zap.Int("gRPC port", cfg.RPCListenPort))
+	if s.rpcListener != nil {
+		serverList = append(serverList, logger.Int("gRPC port", listenerPort(s.rpcListener)))
 	}
-	if cfg.Handler != nil {
+	if s.httpListener != nil {
 		var key = "HTTPS port"
 		if cfg.Insecure {
 			key = "HTTP port"
 		}
-		serverList = append(serverList, zap.Int(key, cfg.HTTPListenPort))
+		serverList = append(serverList, logger.Int(key, listenerPort(s.httpListener)))
 	}
-	serverList = append(serverList, zap.Int("metrics port", cfg.MetricsListenPort))
+	serverList = append(serverList, logger.Int("admin port", listenerPort(s.metricsListener)))
 
 	if cfg.Insecure {
 		cfg.logger.Info("Server listening insecurely on one or more ports", serverList...)
@@ -339,3 +1156,10 @@ func (cfg *Config) logLaunch() {
 		cfg.logger.Info("Server", serverList...)
 	}
 }
+
+func listenerPort(lis net.Listener) int {
+	if addr, ok := lis.Addr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mchudgins/go-service-helper/correlationID"
+	gsh "github.com/mchudgins/go-service-helper/handlers"
+	"github.com/mchudgins/go-service-helper/logger"
+	"github.com/mchudgins/go-service-helper/metrics"
+	"github.com/mchudgins/go-service-helper/route"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	openzipkin "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// testOptions configure a server on ephemeral ports, with its own
+// metrics registry, which logs nothing
+func testOptions(opts ...Option) []Option {
+	return append([]Option{
+		WithHTTPServer(http.NotFoundHandler()),
+		WithHTTPListenPort(0),
+		WithMetricsListenPort(0),
+		WithMetrics(metrics.Registry(prometheus.NewRegistry())),
+		WithStructuredLogger(logger.NewNop()),
+	}, opts...)
+}
+
+func TestStartFailureClosesTracer(t *testing.T) {
+	// invalid buckets fail the construction of the HTTP server, after
+	// the tracer has been constructed
+	s, err := New(testOptions(WithZipkinTracer(), WithHTTPMetrics(gsh.DurationBuckets()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Start(context.Background())
+	if err == nil {
+		t.Fatal("Start succeeded, want an error")
+	}
+	if s.collector != nil {
+		t.Error("the tracer's collector was not closed")
+	}
+	if werr := s.Wait(); werr != err {
+		t.Errorf("Wait() = %v, want %v", werr, err)
+	}
+}
+
+func TestNewLeavesProcessDefaults(t *testing.T) {
+	before := logger.Default()
+
+	s, err := New(testOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logger.Default() != before {
+		t.Error("New replaced the default logger")
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "Wait", call: s.Wait},
+		{name: "Shutdown", call: func() error { return s.Shutdown(context.Background()) }},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); err != errNotServing {
+			t.Errorf("%s before Start = %v, want %v", tt.name, err, errNotServing)
+		}
+	}
+}
+
+func TestProcessDefaults(t *testing.T) {
+	before := logger.Default()
+	defer logger.SetDefault(before)
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		replaced bool
+	}{
+		{name: "embedded"},
+		{name: "process defaults", opts: []Option{WithProcessDefaults()}, replaced: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger.SetDefault(before)
+
+			s, err := New(testOptions(tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Shutdown(context.Background())
+
+			if replaced := logger.Default() == s.cfg.logger; replaced != tt.replaced {
+				t.Errorf("default logger replaced = %t, want %t", replaced, tt.replaced)
+			}
+		})
+	}
+}
+
+// b3Injector injects a mock span's IDs as zipkin's tracer does
+type b3Injector struct{}
+
+func (b3Injector) Inject(sc mocktracer.MockSpanContext, carrier interface{}) error {
+	w := carrier.(opentracing.TextMapWriter)
+	w.Set("X-B3-TraceId", fmt.Sprintf("%016x", sc.TraceID))
+	w.Set("X-B3-SpanId", fmt.Sprintf("%016x", sc.SpanID))
+	return nil
+}
+
+// withTracer makes the servers constructed until the returned function
+// is called trace with tracer
+func withTracer(tracer opentracing.Tracer) func() {
+	before := newTracerAndCollector
+	newTracerAndCollector = func(string) (opentracing.Tracer, openzipkin.Collector, error) {
+		return tracer, nil, nil
+	}
+	return func() { newTracerAndCollector = before }
+}
+
+func TestHTTPLogFields(t *testing.T) {
+	tracer := mocktracer.New()
+	tracer.RegisterInjector(opentracing.TextMap, b3Injector{})
+	defer withTracer(tracer)()
+
+	log := newCapturingLogger()
+	s, err := New(testOptions(WithZipkinTracer(), WithStructuredLogger(log))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	w := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans finished, want 1", len(spans))
+	}
+
+	e, ok := log.find("")
+	if !ok {
+		t.Fatal("the request was not logged")
+	}
+	want := map[string]interface{}{
+		logger.TraceIDKey:       fmt.Sprintf("%016x", spans[0].SpanContext.TraceID),
+		logger.SpanIDKey:        fmt.Sprintf("%016x", spans[0].SpanContext.SpanID),
+		logger.CorrelationIDKey: w.Header().Get(correlationID.CORRID),
+	}
+	for k, v := range want {
+		if e.fields[k] != v {
+			t.Errorf("%s = %v, want %v", k, e.fields[k], v)
+		}
+	}
+}
+
+func TestTracer(t *testing.T) {
+	before := opentracing.GlobalTracer()
+	defer opentracing.SetGlobalTracer(before)
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		replaced bool // the server's tracer became the global tracer
+	}{
+		{name: "embedded"},
+		{name: "process defaults", opts: []Option{WithProcessDefaults()}, replaced: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global := mocktracer.New()
+			opentracing.SetGlobalTracer(global)
+
+			tracer := mocktracer.New()
+			defer withTracer(tracer)()
+
+			s, err := New(testOptions(append(tt.opts, WithZipkinTracer())...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Shutdown(context.Background())
+
+			if replaced := opentracing.GlobalTracer() == tracer; replaced != tt.replaced {
+				t.Errorf("global tracer replaced = %t, want %t", replaced, tt.replaced)
+			}
+
+			// whatever the global tracer, the server traces with its own
+			s.httpServer.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			if n := len(tracer.FinishedSpans()); n != 1 {
+				t.Errorf("the server's tracer finished %d spans, want 1", n)
+			}
+			if n := len(global.FinishedSpans()); n != 0 {
+				t.Errorf("the global tracer finished %d spans, want 0", n)
+			}
+		})
+	}
+}
+
+func TestHTTPRoute(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/things/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	named := mux.NewRouter()
+	named.HandleFunc("/things/{id}", func(w http.ResponseWriter, r *http.Request) {}).Name("thing")
+
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/things/", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		route   interface{}
+	}{
+		{name: "gorilla mux", handler: router, path: "/things/1", route: "/things/{id}"},
+		{name: "gorilla mux, unmatched", handler: router, path: "/other"},
+		{name: "gorilla mux, reused", handler: router, path: "/things/2", route: "/things/{id}"},
+		{name: "gorilla mux, named route", handler: named, path: "/things/1", route: "thing"},
+		{name: "ServeMux", handler: serveMux, path: "/things/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newCapturingLogger()
+			s, err := New(testOptions(WithHTTPServer(tt.handler), WithStructuredLogger(log))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Shutdown(context.Background())
+
+			s.httpServer.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			e, ok := log.find("")
+			if !ok {
+				t.Fatal("the request was not logged")
+			}
+			if e.fields[logger.RouteKey] != tt.route {
+				t.Errorf("route = %v, want %v", e.fields[logger.RouteKey], tt.route)
+			}
+		})
+	}
+
+	// the application's router was not modified, e.g. by installing
+	// route.MuxMiddleware, which would record the route
+	req := httptest.NewRequest(http.MethodGet, "/things/1", nil)
+	req = req.WithContext(route.NewContext(req.Context(), "untouched"))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if got := route.FromContext(req.Context()); got != "untouched" {
+		t.Errorf("the router recorded route %q, want it unmodified", got)
+	}
+}
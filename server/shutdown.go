@@ -2,10 +2,13 @@ package server
 
 import (
 	"context"
-	"os"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
 	"time"
 
-	"go.uber.org/zap"
+	"github.com/mchudgins/go-service-helper/logger"
 )
 
 /*
@@ -21,6 +24,16 @@ const (
 	rpcServer
 )
 
+var (
+	errAlreadyStarted    = errors.New("server has already been started")
+	errShutdownRequested = errors.New("shutdown requested")
+	errNotServing        = errors.New("server is not serving")
+
+	// ErrShutdownTimeout is returned by Wait when the servers did not
+	// stop before the shutdown deadline and were closed forcibly.
+	ErrShutdownTimeout = errors.New("wait time for service shutdown has elapsed")
+)
+
 type eventSource struct {
 	source sourcetype
 	err    error
@@ -32,59 +45,251 @@ func (t sourcetype) String() string {
 	return sourcetypeNames[t]
 }
 
-func (cfg *Config) performGracefulShutdown(ctx context.Context, evtSrc eventSource) {
-	cfg.logger.Info("termination event detected", zap.Error(evtSrc.err), zap.String("source", evtSrc.source.String()))
-	waitDuration := time.Duration(5) * time.Second
-	ctx, cancel := context.WithTimeout(ctx, waitDuration)
+// ShutdownHook performs application cleanup while the server shuts down.
+// The context expires when the hook's timeout elapses; a pre-shutdown
+// hook's also expires with the context given to Shutdown, whereas
+// post-shutdown hooks always have their full timeout.
+type ShutdownHook func(ctx context.Context) error
+
+// ShutdownHookOption configures an individual shutdown hook.
+type ShutdownHookOption func(*shutdownHook)
+
+// HookTimeout limits how long the hook may run (default: 5 seconds).
+func HookTimeout(timeout time.Duration) ShutdownHookOption {
+	return func(h *shutdownHook) { h.timeout = timeout }
+}
+
+type shutdownHook struct {
+	name    string
+	hook    ShutdownHook
+	timeout time.Duration
+}
+
+const (
+	defaultHookTimeout = time.Duration(5) * time.Second
+)
+
+func newShutdownHook(name string, hook ShutdownHook, opts []ShutdownHookOption) shutdownHook {
+	h := shutdownHook{
+		name:    name,
+		hook:    hook,
+		timeout: defaultHookTimeout,
+	}
+	for _, opt := range opts {
+		opt(&h)
+	}
+
+	return h
+}
+
+// run executes the hook, abandoning it if it outlives its timeout
+func (h shutdownHook) run(ctx context.Context, log logger.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- h.hook(ctx)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	// the hook ignored its context; shutdown continues without it
+	start := time.Now()
+	log.Warn("shutdown hook abandoned while still running",
+		logger.String("hook", h.name),
+		logger.Duration("timeout", h.timeout))
+	go func() {
+		err := <-errc
+		log.Info("abandoned shutdown hook returned",
+			logger.String("hook", h.name),
+			logger.Duration("overrun", time.Since(start)),
+			logger.Err(err))
+	}()
+
+	return fmt.Errorf("did not complete: %s", ctx.Err())
+}
+
+// exitCode maps the result of Wait to the process exit status used by Run:
+// 0 for a clean shutdown, 2 if the shutdown deadline elapsed and 1 if a
+// listener or a shutdown hook failed
+func exitCode(err error) int {
+	switch err {
+	case nil:
+		return 0
+	case ErrShutdownTimeout:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// performGracefulShutdown takes the servers down in phases:
+//
+//  1. report the instance as not ready (HTTP /readyz & gRPC health)
+//  2. run the pre-shutdown hooks
+//  3. wait for the drain delay, so load balancers stop sending traffic
+//  4. stop accepting connections & wait for in-flight requests to complete,
+//     up to the shutdown timeout (the admin listener is stopped last)
+//  5. run the post-shutdown hooks
+//
+// and reports why the server stopped.
+func (s *Server) performGracefulShutdown(ctx context.Context, evtSrc eventSource) error {
+	cfg := s.cfg
+	cfg.logger.Info("termination event detected", logger.Err(evtSrc.err), logger.String("source", evtSrc.source.String()))
+
+	// a server which stopped on its own is a failure, an interrupt is not
+	var rc error
+	if evtSrc.source != interrupt && evtSrc.err != http.ErrServerClosed {
+		rc = evtSrc.err
+		if rc == nil {
+			rc = errors.New(evtSrc.source.String() + " stopped unexpectedly")
+		}
+	}
+
+	atomic.StoreInt32(&s.ready, 0)
+	cfg.health.Shutdown()
+
+	hookErr := s.runShutdownHooks(ctx, "pre-shutdown", cfg.preShutdownHooks)
+
+	if cfg.DrainDelay > 0 {
+		cfg.logger.Info("draining", logger.Duration("delay", cfg.DrainDelay))
+		select {
+		case <-time.After(cfg.DrainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, cfg.ShutdownTimeout)
 	defer cancel()
 
+	defer s.hystrixStream.Stop()
+
+	err := s.stopServers(stopCtx, evtSrc.source, httpServer, rpcServer)
+	if err == nil {
+		err = s.stopServers(stopCtx, evtSrc.source, metricsServer)
+	}
+	if err != nil {
+		cfg.logger.Warn("wait time for service shutdown has elapsed -- performing hard shutdown", logger.Err(stopCtx.Err()))
+		s.forceClose()
+	} else {
+		cfg.logger.Info("server shutdown complete")
+	}
+
+	// the shutdown deadline may have passed; each post-shutdown hook
+	// still gets its own timeout
+	if postErr := s.runShutdownHooks(context.Background(), "post-shutdown", cfg.postShutdownHooks); hookErr == nil {
+		hookErr = postErr
+	}
+
+	// report the most significant problem
+	switch {
+	case rc != nil:
+		return rc
+	case err != nil:
+		return err
+	default:
+		return hookErr
+	}
+}
+
+// stopServers gracefully stops the given servers (other than the one
+// which generated the termination event), returning ErrShutdownTimeout
+// if they do not complete before ctx expires
+func (s *Server) stopServers(ctx context.Context, skip sourcetype, servers ...sourcetype) error {
 	waitEvents := 0
-	evtc := make(chan eventSource)
-	defer close(evtc)
-
-	if evtSrc.source != httpServer && cfg.httpServer != nil {
-		waitEvents++
-		go func() {
-			evtc <- eventSource{
-				err:    cfg.httpServer.Shutdown(ctx),
-				source: httpServer,
-			}
-		}()
-	}
-	if evtSrc.source != rpcServer && cfg.rpcServer != nil {
-		waitEvents++
-		go func() {
-			cfg.rpcServer.GracefulStop()
-			evtc <- eventSource{source: rpcServer}
-		}()
-	}
-	if evtSrc.source != metricsServer && cfg.metricsServer != nil {
-		waitEvents++
-		go func() {
-			evtc <- eventSource{
-				err:    cfg.metricsServer.Shutdown(ctx),
-				source: metricsServer,
-			}
-		}()
+	evtc := make(chan eventSource, len(servers))
+
+	for _, source := range servers {
+		if source == skip {
+			continue
+		}
+
+		switch {
+		case source == httpServer && s.httpServer != nil:
+			waitEvents++
+			go func() {
+				evtc <- eventSource{
+					err:    s.httpServer.Shutdown(ctx),
+					source: httpServer,
+				}
+			}()
+
+		case source == rpcServer && s.rpcServer != nil:
+			waitEvents++
+			go func() {
+				s.rpcServer.GracefulStop()
+				evtc <- eventSource{source: rpcServer}
+			}()
+
+		case source == metricsServer && s.metricsServer != nil:
+			waitEvents++
+			go func() {
+				evtc <- eventSource{
+					err:    s.metricsServer.Shutdown(ctx),
+					source: metricsServer,
+				}
+			}()
+		}
 	}
 
 	// wait for shutdown to complete or time to expire
-	for {
+	for waitEvents > 0 {
 		select {
-		case <-time.After(time.Duration(4) * time.Second):
-			cfg.logger.Info("server shutdown complete")
-			os.Exit(1)
-
 		case <-ctx.Done():
-			cfg.logger.Warn("wait time for service shutdown has elapsed -- performing hard shutdown", zap.Error(ctx.Err()))
-			os.Exit(2)
+			return ErrShutdownTimeout
 
 		case evt := <-evtc:
 			waitEvents--
-			cfg.logger.Info("shutdown event recv'ed", zap.Error(evt.err), zap.String("eventSource", evt.source.String()))
-			if waitEvents == 0 {
-				os.Exit(0)
+			s.cfg.logger.Info("shutdown event recv'ed", logger.Err(evt.err), logger.String("eventSource", evt.source.String()))
+		}
+	}
+
+	return nil
+}
+
+// runShutdownHooks runs each hook in the order registered, logging any
+// failures; it returns the first error encountered
+func (s *Server) runShutdownHooks(ctx context.Context, phase string, hooks []shutdownHook) error {
+	var rc error
+
+	for _, h := range hooks {
+		start := time.Now()
+		err := h.run(ctx, s.cfg.logger)
+		if err != nil {
+			s.cfg.logger.Error("shutdown hook failed",
+				logger.String("phase", phase),
+				logger.String("hook", h.name),
+				logger.Duration("duration", time.Since(start)),
+				logger.Err(err))
+			if rc == nil {
+				rc = fmt.Errorf("%s hook %s failed: %s", phase, h.name, err)
 			}
+			continue
 		}
+
+		s.cfg.logger.Info("shutdown hook complete",
+			logger.String("phase", phase),
+			logger.String("hook", h.name),
+			logger.Duration("duration", time.Since(start)))
+	}
+
+	return rc
+}
+
+// forceClose terminates any connections which are still open
+func (s *Server) forceClose() {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+	if s.rpcServer != nil {
+		s.rpcServer.Stop()
+	}
+	if s.metricsServer != nil {
+		s.metricsServer.Close()
 	}
 }
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownHookRun(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	release := make(chan struct{})
+	defer close(release)
+
+	tests := []struct {
+		name      string
+		hook      ShutdownHook
+		err       string
+		abandoned bool
+	}{
+		{name: "succeeds", hook: func(context.Context) error { return nil }},
+		{name: "fails", hook: func(context.Context) error { return errors.New("failed") }, err: "failed"},
+		{
+			name: "ignores its context",
+			hook: func(context.Context) error {
+				<-release
+				return nil
+			},
+			err:       "did not complete",
+			abandoned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newCapturingLogger()
+			h := newShutdownHook(tt.name, tt.hook, []ShutdownHookOption{HookTimeout(timeout)})
+
+			err := h.run(context.Background(), log)
+			if len(tt.err) == 0 && err != nil || len(tt.err) > 0 && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("run() = %v, want %q", err, tt.err)
+			}
+			if _, abandoned := log.find("shutdown hook abandoned while still running"); abandoned != tt.abandoned {
+				t.Errorf("abandonment logged = %t, want %t", abandoned, tt.abandoned)
+			}
+		})
+	}
+}
+
+func TestShutdownPhases(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a pre-shutdown hook's context expires with the shutdown context,
+	// so one is only registered when that is live
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		phases string
+	}{
+		{name: "shutdown", ctx: context.Background(), phases: "pre,post"},
+		{name: "expired shutdown context", ctx: canceled, phases: "post"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mutex  sync.Mutex
+				phases []string
+				s      *Server
+			)
+			record := func(phase string) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				phases = append(phases, phase)
+			}
+
+			opts := []Option{
+				WithShutdownHook("post", func(ctx context.Context) error {
+					// the hook has its own deadline, whatever the shutdown context's state
+					deadline, ok := ctx.Deadline()
+					if ctx.Err() != nil || !ok || time.Until(deadline) < time.Second {
+						t.Errorf("post-shutdown hook context: err %v, deadline %v", ctx.Err(), deadline)
+					}
+					record("post")
+					return nil
+				}, HookTimeout(time.Minute)),
+			}
+			if tt.ctx.Err() == nil {
+				opts = append(opts, WithPreShutdownHook("pre", func(context.Context) error {
+					if atomic.LoadInt32(&s.ready) != 0 {
+						t.Error("the server was ready during the pre-shutdown hooks")
+					}
+					record("pre")
+					return nil
+				}))
+			}
+
+			s, err := New(testOptions(opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			s.Shutdown(tt.ctx)
+			s.Wait()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if got := strings.Join(phases, ","); got != tt.phases {
+				t.Errorf("phases = %s, want %s", got, tt.phases)
+			}
+		})
+	}
+}
+
+func TestRunShutdownHooks(t *testing.T) {
+	failed := errors.New("failed")
+
+	tests := []struct {
+		name    string
+		results []error // of hooks "0", "1", ...
+		err     string
+	}{
+		{name: "none"},
+		{name: "succeed", results: []error{nil, nil}},
+		{name: "one fails", results: []error{nil, failed, nil}, err: "post-shutdown hook 1 failed: failed"},
+		{name: "first failure reported", results: []error{failed, failed}, err: "post-shutdown hook 0 failed: failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ran []string
+			var hooks []shutdownHook
+			for i, result := range tt.results {
+				name, result := fmt.Sprint(i), result
+				hooks = append(hooks, newShutdownHook(name, func(context.Context) error {
+					ran = append(ran, name)
+					return result
+				}, nil))
+			}
+
+			s := &Server{cfg: &Config{logger: newCapturingLogger()}}
+			err := s.runShutdownHooks(context.Background(), "post-shutdown", hooks)
+
+			if len(tt.err) == 0 && err != nil || len(tt.err) > 0 && (err == nil || err.Error() != tt.err) {
+				t.Errorf("runShutdownHooks() = %v, want %q", err, tt.err)
+			}
+			// every hook runs, in the order registered, despite failures
+			if len(ran) != len(tt.results) {
+				t.Fatalf("ran %v, want %d hooks", ran, len(tt.results))
+			}
+			for i, name := range ran {
+				if name != fmt.Sprint(i) {
+					t.Errorf("ran %v, want them in order", ran)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{err: nil, code: 0},
+		{err: ErrShutdownTimeout, code: 2},
+		{err: errors.New("post-shutdown hook failed"), code: 1},
+	}
+
+	for _, tt := range tests {
+		if code := exitCode(tt.err); code != tt.code {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, code, tt.code)
+		}
+	}
+}
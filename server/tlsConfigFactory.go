@@ -11,21 +11,100 @@ package server
 
 import (
 	"crypto/tls"
+	"fmt"
 )
 
-// This configuration is for internal connections as the
-// configuration is as strict as possible.
-
-func tlsConfigFactory() *tls.Config {
-	cfg := &tls.Config{
-		PreferServerCipherSuites: true,             // don't let the client drive the cipher selection
-		MinVersion:               tls.VersionTLS12, // only support TLS v1.2
-		MaxVersion:               tls.VersionTLS12,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-		},
+// TLSProfile selects one of the Mozilla server side TLS guidelines.
+// The zero value, TLSProfileIntermediate, is the default.
+type TLSProfile int
+
+const (
+	// TLSProfileIntermediate supports TLS v1.2 & v1.3 with AEAD ciphers
+	// only; suitable for general purpose servers.
+	TLSProfileIntermediate TLSProfile = iota
+
+	// TLSProfileModern supports TLS v1.3 only; suitable for internal
+	// connections where every client is known to be current.
+	TLSProfileModern
+
+	// TLSProfileOld supports TLS v1.0 and above, including CBC and 3DES
+	// ciphers; use it only for legacy clients which require it.
+	TLSProfileOld
+)
+
+func (p TLSProfile) String() string {
+	switch p {
+	case TLSProfileIntermediate:
+		return "intermediate"
+	case TLSProfileModern:
+		return "modern"
+	case TLSProfileOld:
+		return "old"
+	default:
+		return fmt.Sprintf("TLSProfile(%d)", int(p))
+	}
+}
+
+// both ECDSA & RSA suites are listed, so either type of certificate may be used
+var (
+	intermediateCipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
 	}
 
-	return cfg
+	oldCipherSuites = append(append([]uint16{}, intermediateCipherSuites...),
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+		tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	)
+
+	curvePreferences = []tls.CurveID{
+		tls.X25519,
+		tls.CurveP256,
+		tls.CurveP384,
+	}
+)
+
+// tlsConfigFactory returns a new configuration for the given profile.
+// (TLS v1.3 cipher suites are not configurable, so only the TLS v1.2
+// and earlier suites are listed.)
+func tlsConfigFactory(profile TLSProfile) (*tls.Config, error) {
+	switch profile {
+	case TLSProfileModern:
+		return &tls.Config{
+			MinVersion:       tls.VersionTLS13,
+			CurvePreferences: curvePreferences,
+		}, nil
+
+	case TLSProfileIntermediate:
+		return &tls.Config{
+			MinVersion:       tls.VersionTLS12,
+			CipherSuites:     intermediateCipherSuites,
+			CurvePreferences: curvePreferences,
+		}, nil
+
+	case TLSProfileOld:
+		return &tls.Config{
+			PreferServerCipherSuites: true, // don't let the client drive the cipher selection
+			MinVersion:               tls.VersionTLS10,
+			CipherSuites:             oldCipherSuites,
+			CurvePreferences:         curvePreferences,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown TLS profile %s", profile)
+	}
 }
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSConfigFactory(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	certFilename, keyFilename := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+
+	now := time.Now()
+	writeCertificate(t, certFilename, keyFilename, "localhost", now.Add(-time.Hour), now.Add(time.Hour))
+	cert, err := loadCertificate(certFilename, keyFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+
+	tests := []struct {
+		name       string
+		profile    TLSProfile
+		minVersion uint16 // offered by the client
+		maxVersion uint16
+		version    uint16 // negotiated; zero if the handshake fails
+	}{
+		{name: "intermediate, TLS v1.3", profile: TLSProfileIntermediate, version: tls.VersionTLS13},
+		{name: "intermediate, TLS v1.2", profile: TLSProfileIntermediate, maxVersion: tls.VersionTLS12, version: tls.VersionTLS12},
+		{name: "intermediate, TLS v1.1", profile: TLSProfileIntermediate, minVersion: tls.VersionTLS10, maxVersion: tls.VersionTLS11},
+		{name: "modern, TLS v1.3", profile: TLSProfileModern, version: tls.VersionTLS13},
+		{name: "modern, TLS v1.2", profile: TLSProfileModern, maxVersion: tls.VersionTLS12},
+		{name: "old, TLS v1.0", profile: TLSProfileOld, minVersion: tls.VersionTLS10, maxVersion: tls.VersionTLS10, version: tls.VersionTLS10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConfig, err := tlsConfigFactory(tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			serverConfig.Certificates = []tls.Certificate{*cert}
+
+			l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			go func() {
+				if conn, err := l.Accept(); err == nil {
+					conn.(*tls.Conn).Handshake()
+					conn.Close()
+				}
+			}()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := tls.Client(conn, &tls.Config{
+				ServerName: "localhost",
+				RootCAs:    roots,
+				MinVersion: tt.minVersion,
+				MaxVersion: tt.maxVersion,
+			})
+			defer client.Close()
+			err = client.Handshake()
+
+			switch {
+			case tt.version == 0 && err == nil:
+				t.Errorf("negotiated %s, want a failed handshake", tls.VersionName(client.ConnectionState().Version))
+			case tt.version != 0 && err != nil:
+				t.Errorf("handshake failed: %v", err)
+			case tt.version != 0 && client.ConnectionState().Version != tt.version:
+				t.Errorf("negotiated %s, want %s", tls.VersionName(client.ConnectionState().Version), tls.VersionName(tt.version))
+			}
+		})
+	}
+
+	if _, err := tlsConfigFactory(TLSProfile(42)); err == nil {
+		t.Error("tlsConfigFactory(TLSProfile(42)) succeeded, want an error")
+	}
+}
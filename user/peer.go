@@ -0,0 +1,84 @@
+package user
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// Peer describes the identity presented by a client certificate
+// which was verified during the TLS handshake.
+type Peer struct {
+	Subject        string
+	Issuer         string
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []string
+	URIs           []string
+	SPIFFEID       string // set only if the certificate is an X.509-SVID
+}
+
+type peerKey struct{}
+
+var (
+	peerIdentity peerKey
+)
+
+// PeerFromCertificate extracts the identity from a client certificate.
+// Per the SPIFFE X.509-SVID specification, a certificate carries a
+// SPIFFE ID only if its sole URI SAN is a spiffe URI.
+func PeerFromCertificate(cert *x509.Certificate) *Peer {
+	p := &Peer{
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+
+	for _, ip := range cert.IPAddresses {
+		p.IPAddresses = append(p.IPAddresses, ip.String())
+	}
+	for _, u := range cert.URIs {
+		p.URIs = append(p.URIs, u.String())
+	}
+	if len(cert.URIs) == 1 && cert.URIs[0].Scheme == "spiffe" && len(cert.URIs[0].Host) > 0 {
+		p.SPIFFEID = cert.URIs[0].String()
+	}
+
+	return p
+}
+
+// PeerFromConnectionState returns the identity of the verified client
+// certificate, or nil if the client did not present a verified certificate.
+func PeerFromConnectionState(cs *tls.ConnectionState) *Peer {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return PeerFromCertificate(cs.VerifiedChains[0][0])
+}
+
+// PeerFromRequest stores the verified client identity, if any,
+// in the request's context.
+func PeerFromRequest(req *http.Request) (*http.Request, *Peer) {
+	p := PeerFromConnectionState(req.TLS)
+	if p != nil {
+		ctx := NewPeerContext(req.Context(), p)
+		req = req.WithContext(ctx)
+	}
+
+	return req, p
+}
+
+func PeerFromContext(ctx context.Context) *Peer {
+	val, ok := ctx.Value(peerIdentity).(*Peer)
+	if ok {
+		return val
+	}
+	return nil
+}
+
+func NewPeerContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerIdentity, p)
+}
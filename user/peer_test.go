@@ -0,0 +1,158 @@
+package user
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func certificate(cn string, uris ...string) *x509.Certificate {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: cn},
+		Issuer:  pkix.Name{CommonName: "ca"},
+	}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			panic(err)
+		}
+		cert.URIs = append(cert.URIs, u)
+	}
+	return cert
+}
+
+func TestPeerFromConnectionState(t *testing.T) {
+	client := certificate("client")
+	tests := []struct {
+		name    string
+		cs      *tls.ConnectionState
+		subject string // empty if no peer is expected
+	}{
+		{name: "nil state", cs: nil},
+		{name: "empty state", cs: &tls.ConnectionState{}},
+		{name: "unverified certificate", cs: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}},
+		{name: "empty chain", cs: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{}}}},
+		{
+			name: "verified certificate",
+			cs: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{client},
+				VerifiedChains:   [][]*x509.Certificate{{client, certificate("ca")}},
+			},
+			subject: "CN=client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := PeerFromConnectionState(tt.cs)
+			switch {
+			case len(tt.subject) == 0 && p != nil:
+				t.Errorf("PeerFromConnectionState() = %+v, want nil", p)
+			case len(tt.subject) != 0 && p == nil:
+				t.Error("PeerFromConnectionState() = nil, want a peer")
+			case p != nil && p.Subject != tt.subject:
+				t.Errorf("Subject = %q, want %q", p.Subject, tt.subject)
+			}
+		})
+	}
+}
+
+func TestPeerFromCertificate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		uris     []string
+		spiffeID string
+	}{
+		{name: "no URIs", cert: certificate("client")},
+		{
+			name: "https URI",
+			cert: certificate("client", "https://example.com/client"),
+			uris: []string{"https://example.com/client"},
+		},
+		{
+			name:     "SPIFFE ID",
+			cert:     certificate("client", "spiffe://example.com/ns/default/sa/client"),
+			uris:     []string{"spiffe://example.com/ns/default/sa/client"},
+			spiffeID: "spiffe://example.com/ns/default/sa/client",
+		},
+		{
+			name: "SPIFFE URI without a trust domain",
+			cert: certificate("client", "spiffe:///client"),
+			uris: []string{"spiffe:///client"},
+		},
+		{
+			name: "several SPIFFE URIs",
+			cert: certificate("client", "spiffe://example.com/a", "spiffe://example.com/b"),
+			uris: []string{"spiffe://example.com/a", "spiffe://example.com/b"},
+		},
+		{
+			name: "SPIFFE and https URIs",
+			cert: certificate("client", "https://example.com/client", "spiffe://example.com/client"),
+			uris: []string{"https://example.com/client", "spiffe://example.com/client"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := PeerFromCertificate(tt.cert)
+			if !reflect.DeepEqual(p.URIs, tt.uris) {
+				t.Errorf("URIs = %q, want %q", p.URIs, tt.uris)
+			}
+			if p.SPIFFEID != tt.spiffeID {
+				t.Errorf("SPIFFEID = %q, want %q", p.SPIFFEID, tt.spiffeID)
+			}
+		})
+	}
+}
+
+func TestPeerFromCertificateSANs(t *testing.T) {
+	cert := certificate("client")
+	cert.DNSNames = []string{"client.example.com"}
+	cert.EmailAddresses = []string{"client@example.com"}
+	cert.IPAddresses = []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")}
+
+	want := &Peer{
+		Subject:        "CN=client",
+		Issuer:         "CN=ca",
+		DNSNames:       []string{"client.example.com"},
+		EmailAddresses: []string{"client@example.com"},
+		IPAddresses:    []string{"10.0.0.1", "fd00::1"},
+	}
+	if p := PeerFromCertificate(cert); !reflect.DeepEqual(p, want) {
+		t.Errorf("PeerFromCertificate() = %+v, want %+v", p, want)
+	}
+}
+
+func TestPeerFromRequest(t *testing.T) {
+	client := certificate("client")
+	tests := []struct {
+		name string
+		cs   *tls.ConnectionState
+		peer bool
+	}{
+		{name: "plaintext"},
+		{name: "no client certificate", cs: &tls.ConnectionState{}},
+		{name: "verified certificate", cs: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{client}}}, peer: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.TLS = tt.cs
+
+			req, p := PeerFromRequest(req)
+			if (p != nil) != tt.peer {
+				t.Fatalf("PeerFromRequest() = %+v, want peer %v", p, tt.peer)
+			}
+			if got := PeerFromContext(req.Context()); got != p {
+				t.Errorf("PeerFromContext() = %+v, want %+v", got, p)
+			}
+		})
+	}
+}
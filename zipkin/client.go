@@ -25,10 +25,11 @@ func (c *TraceClient) Do(r *http.Request) (*http.Response, error) {
 
 	ctx := r.Context()
 
-	// send any correlation ID on to the servers we contact
+	// send any correlation ID on to the servers we contact, in the
+	// header configured by correlationID.SetDefault
 	corrID := correlationID.FromContext(ctx)
 	if len(corrID) > 0 {
-		r.Header.Set(correlationID.CORRID, corrID)
+		r.Header.Set(correlationID.Default().Header(), corrID)
 	}
 
 	// enable tracing